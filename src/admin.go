@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// cacheInfo describes a cached entry for the admin routes
+type cacheInfo struct {
+	Key        string    `json:"key"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	FreshUntil time.Time `json:"fresh_until"`
+	Expires    time.Time `json:"expires"`
+	Size       int       `json:"size"`
+	Stale      bool      `json:"stale"`
+}
+
+// requireAdmin only lets requests through that carry the admin token as bearer token
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if config.AdminToken == "" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": "Admin routes are disabled",
+			})
+			return
+		}
+
+		// The scheme is required, a bare token is not accepted
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": "Invalid admin token",
+			})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func adminCacheListHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	list := []cacheInfo{}
+
+	for key, entry := range cacheStore.Entries() {
+		// Schedules are stored decoded, their size is the size of them encoded again
+		size := 0
+		if body, ok := entry.Value.(*string); ok {
+			size = len(*body)
+		} else if data, err := json.Marshal(entry.Value); err == nil {
+			size = len(data)
+		}
+
+		list = append(list, cacheInfo{
+			Key:        key,
+			FetchedAt:  entry.FetchedAt,
+			FreshUntil: entry.FreshUntil,
+			Expires:    entry.UsableUntil,
+			Size:       size,
+			Stale:      now.After(entry.FreshUntil),
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": list,
+	})
+}
+
+func adminCachePurgeAllHandler(w http.ResponseWriter, r *http.Request) {
+	cacheStore.Flush()
+	log.Printf("Purged the whole cache")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminCachePurgeHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := requestedEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	cacheStore.Delete(endpoint)
+	// The same URL may also have been requested through the API proxy
+	cacheStore.Delete("api:" + mux.Vars(r)["endpoint"])
+	log.Printf("Purged '%s' from the cache", endpoint)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := requestedEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	horaro, err := refreshHoraro(endpoint)
+	if err != nil {
+		writeUpstreamError(w, endpoint, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"endpoint": endpoint,
+		"updated":  JSONTime{horaro.Schedule.Updated},
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotArchive stores the versions of the schedules seen by the proxy, by their update time
+type snapshotArchive interface {
+	// Record stores the version unless it's already stored
+	Record(endpoint string, horaro *HoraroResponse)
+	// Versions lists the update times of the stored versions, oldest first
+	Versions(endpoint string) []time.Time
+	// Get returns the version that was updated at the time
+	Get(endpoint string, updated time.Time) (*HoraroResponse, bool)
+}
+
+var archive snapshotArchive = newMemoryArchive(config.ArchiveVersions)
+
+// archivedVersions is the update time of the last version recorded of every schedule, so a schedule served from
+// the cache is only recorded once
+var archivedVersions sync.Map
+
+func init() {
+	onScheduleChange(func(endpoint string, previous, current *HoraroResponse) {
+		if previous != nil {
+			archive.Record(endpoint, previous)
+		}
+		archiveCurrent(endpoint, current)
+	})
+}
+
+// archiveCurrent records the schedule unless it was recorded already. Schedules loaded from the disk cache are
+// never seen as a change, so they are recorded when they are served.
+func archiveCurrent(endpoint string, horaro *HoraroResponse) {
+	if updated, ok := archivedVersions.Load(endpoint); ok && updated.(time.Time).Equal(horaro.Schedule.Updated) {
+		return
+	}
+
+	archive.Record(endpoint, horaro)
+	archivedVersions.Store(endpoint, horaro.Schedule.Updated)
+}
+
+// newSnapshotArchive creates the archive selected in the config
+func newSnapshotArchive(cfg *Config) (snapshotArchive, error) {
+	switch cfg.ArchiveBackend {
+	case "memory":
+		return newMemoryArchive(cfg.ArchiveVersions), nil
+	case "disk":
+		return newDiskArchive(cfg.ArchiveDirectory, cfg.ArchiveVersions)
+	}
+
+	return nil, fmt.Errorf("Unknown archive backend '%s'", cfg.ArchiveBackend)
+}
+
+// snapshotBefore returns the newest version of the schedule that was updated before the time, or nil
+func snapshotBefore(endpoint string, before time.Time) *HoraroResponse {
+	versions := archive.Versions(endpoint)
+	index := sort.Search(len(versions), func(i int) bool {
+		return !versions[i].Before(before)
+	})
+	if index == 0 {
+		return nil
+	}
+
+	horaro, ok := archive.Get(endpoint, versions[index-1])
+	if !ok {
+		return nil
+	}
+
+	return horaro
+}
+
+// snapshotAt returns the version of the schedule that was current at the time, or nil
+func snapshotAt(endpoint string, at time.Time) *HoraroResponse {
+	return snapshotBefore(endpoint, at.Add(time.Nanosecond))
+}
+
+// memoryArchiveSchedules is the number of schedules kept by the memory archive, the one recorded least recently
+// is removed first
+const memoryArchiveSchedules = 100
+
+// memoryArchive keeps the latest versions in memory, they are lost on restart
+type memoryArchive struct {
+	limit int
+
+	mu        sync.RWMutex
+	snapshots map[string][]*HoraroResponse
+	recorded  map[string]time.Time
+}
+
+func newMemoryArchive(limit int) *memoryArchive {
+	return &memoryArchive{
+		limit:     limit,
+		snapshots: make(map[string][]*HoraroResponse),
+		recorded:  make(map[string]time.Time),
+	}
+}
+
+func (a *memoryArchive) Record(endpoint string, horaro *HoraroResponse) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.recorded[endpoint] = time.Now()
+	snapshots := a.snapshots[endpoint]
+	updated := horaro.Schedule.Updated
+
+	index := sort.Search(len(snapshots), func(i int) bool {
+		return !snapshots[i].Schedule.Updated.Before(updated)
+	})
+	if index < len(snapshots) && snapshots[index].Schedule.Updated.Equal(updated) {
+		return
+	}
+
+	snapshots = append(snapshots, nil)
+	copy(snapshots[index+1:], snapshots[index:])
+	snapshots[index] = horaro
+
+	if len(snapshots) > a.limit {
+		snapshots = snapshots[len(snapshots)-a.limit:]
+	}
+	a.snapshots[endpoint] = snapshots
+
+	if len(a.snapshots) > memoryArchiveSchedules {
+		oldest := endpoint
+		for other, recorded := range a.recorded {
+			if recorded.Before(a.recorded[oldest]) {
+				oldest = other
+			}
+		}
+
+		delete(a.snapshots, oldest)
+		delete(a.recorded, oldest)
+	}
+}
+
+func (a *memoryArchive) Versions(endpoint string) []time.Time {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	versions := make([]time.Time, len(a.snapshots[endpoint]))
+	for i, horaro := range a.snapshots[endpoint] {
+		versions[i] = horaro.Schedule.Updated
+	}
+
+	return versions
+}
+
+func (a *memoryArchive) Get(endpoint string, updated time.Time) (*HoraroResponse, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, horaro := range a.snapshots[endpoint] {
+		if horaro.Schedule.Updated.Equal(updated) {
+			return horaro, true
+		}
+	}
+
+	return nil, false
+}
+
+// archiveFile is the JSON format of a version on disk
+type archiveFile struct {
+	Endpoint   string          `json:"endpoint"`
+	ArchivedAt time.Time       `json:"archived_at"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// diskArchive stores every version as a JSON file named by its update time, in a directory per schedule
+type diskArchive struct {
+	directory string
+	limit     int
+}
+
+func newDiskArchive(directory string, limit int) (*diskArchive, error) {
+	err := os.MkdirAll(directory, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskArchive{directory: directory, limit: limit}, nil
+}
+
+func (a *diskArchive) scheduleDirectory(endpoint string) string {
+	h := fnv.New64a()
+	h.Write([]byte(endpoint))
+	return filepath.Join(a.directory, fmt.Sprintf("%016x", h.Sum64()))
+}
+
+func (a *diskArchive) path(endpoint string, updated time.Time) string {
+	return filepath.Join(a.scheduleDirectory(endpoint), fmt.Sprintf("%d.json", updated.UnixNano()))
+}
+
+func (a *diskArchive) Record(endpoint string, horaro *HoraroResponse) {
+	path := a.path(endpoint, horaro.Schedule.Updated)
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+
+	value, err := json.Marshal(horaro)
+	if err != nil {
+		log.Printf("Could not encode snapshot of '%s': %s", endpoint, err.Error())
+		return
+	}
+
+	data, err := json.Marshal(archiveFile{Endpoint: endpoint, ArchivedAt: time.Now(), Value: value})
+	if err != nil {
+		log.Printf("Could not encode snapshot of '%s': %s", endpoint, err.Error())
+		return
+	}
+
+	directory := a.scheduleDirectory(endpoint)
+	err = os.MkdirAll(directory, 0o755)
+	if err != nil {
+		log.Printf("Could not write snapshot of '%s': %s", endpoint, err.Error())
+		return
+	}
+
+	// Write to a temporary file first, so readers never see a partially written version
+	temp, err := os.CreateTemp(directory, "*.tmp")
+	if err != nil {
+		log.Printf("Could not write snapshot of '%s': %s", endpoint, err.Error())
+		return
+	}
+
+	_, err = temp.Write(data)
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		log.Printf("Could not write snapshot of '%s': %s", endpoint, err.Error())
+		return
+	}
+
+	// Remove the oldest versions beyond the limit
+	versions := a.Versions(endpoint)
+	for len(versions) > a.limit {
+		os.Remove(a.path(endpoint, versions[0]))
+		versions = versions[1:]
+	}
+}
+
+func (a *diskArchive) Versions(endpoint string) []time.Time {
+	paths, _ := filepath.Glob(filepath.Join(a.scheduleDirectory(endpoint), "*.json"))
+
+	versions := make([]time.Time, 0, len(paths))
+	for _, path := range paths {
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, time.Unix(0, nanos).UTC())
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Before(versions[j])
+	})
+
+	return versions
+}
+
+func (a *diskArchive) Get(endpoint string, updated time.Time) (*HoraroResponse, bool) {
+	path := a.path(endpoint, updated)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var file archiveFile
+	err = json.Unmarshal(data, &file)
+	if err != nil || file.Endpoint != endpoint {
+		return nil, false
+	}
+
+	var horaro HoraroResponse
+	err = json.Unmarshal(file.Value, &horaro)
+	if err != nil {
+		log.Printf("Could not decode snapshot '%s': %s", path, err.Error())
+		return nil, false
+	}
+
+	return &horaro, true
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// cacheStatus describes how a response relates to the cache, it is sent to clients in X-Cache-Status
+type cacheStatus string
+
+const (
+	cacheHit   cacheStatus = "HIT"
+	cacheMiss  cacheStatus = "MISS"
+	cacheStale cacheStatus = "STALE"
+)
+
+// retryInterval is the time to wait before refreshing a stale entry again after a failed refresh
+const retryInterval = 30 * time.Second
+
+// cacheEntry is a value fetched from Horaro together with the times it may be served
+type cacheEntry struct {
+	Value     interface{}
+	FetchedAt time.Time
+	// FreshUntil is the time until which the value is served without refreshing it
+	FreshUntil time.Time
+	// UsableUntil is the time until which the value is served while it is being refreshed or Horaro is down
+	UsableUntil time.Time
+	// RetryAt is the time before which no new refresh is started after a failed one
+	RetryAt time.Time
+	// Validators are sent to Horaro on refresh so unchanged data doesn't have to be downloaded again
+	Validators Validators
+}
+
+// fetchFunc fetches a new value from Horaro, previous is the entry being refreshed or nil if there is none
+type fetchFunc func(previous *cacheEntry) (interface{}, Validators, error)
+
+// cacheBackend stores the entries fetched from Horaro, entries are removed once they are no longer usable
+type cacheBackend interface {
+	Get(key string) (*cacheEntry, bool)
+	Set(key string, entry *cacheEntry)
+	Delete(key string)
+	Flush()
+	// Entries returns all usable entries by key
+	Entries() map[string]*cacheEntry
+}
+
+var cleanupInterval = 60 * time.Minute
+var cacheStore cacheBackend = newMemoryBackend()
+
+// newCacheBackend creates the backend selected in the config
+func newCacheBackend(cfg *Config) (cacheBackend, error) {
+	switch cfg.CacheBackend {
+	case "memory":
+		return newMemoryBackend(), nil
+	case "disk":
+		return newDiskBackend(cfg.CacheDirectory)
+	}
+
+	return nil, fmt.Errorf("Unknown cache backend '%s'", cfg.CacheBackend)
+}
+
+// memoryBackend keeps the entries in memory, they are lost on restart
+type memoryBackend struct {
+	cache *cache.Cache
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{cache: cache.New(cache.NoExpiration, cleanupInterval)}
+}
+
+func (b *memoryBackend) Get(key string) (*cacheEntry, bool) {
+	value, found := b.cache.Get(key)
+	if !found {
+		return nil, false
+	}
+
+	entry, ok := value.(*cacheEntry)
+	return entry, ok
+}
+
+func (b *memoryBackend) Set(key string, entry *cacheEntry) {
+	// go-cache never expires items without a positive duration
+	ttl := time.Until(entry.UsableUntil)
+	if ttl <= 0 {
+		b.cache.Delete(key)
+		return
+	}
+
+	b.cache.Set(key, entry, ttl)
+}
+
+func (b *memoryBackend) Delete(key string) {
+	b.cache.Delete(key)
+}
+
+func (b *memoryBackend) Flush() {
+	b.cache.Flush()
+}
+
+func (b *memoryBackend) Entries() map[string]*cacheEntry {
+	entries := make(map[string]*cacheEntry)
+	for key, item := range b.cache.Items() {
+		if entry, ok := item.Object.(*cacheEntry); ok {
+			entries[key] = entry
+		}
+	}
+
+	return entries
+}
+
+// fetchGroup coalesces concurrent fetches of the same endpoint into a single request to Horaro
+var fetchGroup flightGroup
+
+// backgroundRefreshes holds the keys that are being refreshed in the background, so a burst of stale hits starts
+// only one refresh
+var backgroundRefreshes sync.Map
+
+// getCached returns the cached value for the key, fetching it when it's missing.
+// Stale values are returned immediately while they are refreshed in the background.
+func getCached(key string, fetch fetchFunc) (*cacheEntry, cacheStatus, error) {
+	entry := lookupCache(key)
+	now := time.Now()
+
+	if entry != nil && now.Before(entry.FreshUntil) {
+		return entry, cacheHit, nil
+	}
+
+	if entry != nil {
+		if now.After(entry.RetryAt) {
+			if _, refreshing := backgroundRefreshes.LoadOrStore(key, struct{}{}); !refreshing {
+				go func() {
+					defer backgroundRefreshes.Delete(key)
+
+					_, err := refreshCache(key, fetch)
+					if err != nil {
+						log.Printf("Could not refresh '%s', serving stale data: %s", key, err.Error())
+					}
+				}()
+			}
+		}
+
+		return entry, cacheStale, nil
+	}
+
+	entry, err := refreshCache(key, fetch)
+	if err != nil {
+		return nil, cacheMiss, err
+	}
+
+	return entry, cacheMiss, nil
+}
+
+// refreshCache fetches a new value for the key and stores it.
+// When the fetch fails the previous value is kept and refreshing is postponed.
+func refreshCache(key string, fetch fetchFunc) (*cacheEntry, error) {
+	value, err, _ := fetchGroup.Do(key, func() (interface{}, error) {
+		previous := lookupCache(key)
+		value, validators, err := fetch(previous)
+		now := time.Now()
+
+		if errors.Is(err, ErrNotModified) && previous != nil {
+			value, err = previous.Value, nil
+		}
+
+		if err != nil {
+			if previous != nil {
+				retry := *previous
+				retry.RetryAt = now.Add(retryInterval)
+				storeCache(key, &retry)
+			}
+
+			return nil, err
+		}
+
+		entry := &cacheEntry{
+			Value:       value,
+			FetchedAt:   now,
+			FreshUntil:  now.Add(config.CacheTTL.Duration),
+			UsableUntil: now.Add(config.CacheTTL.Duration + config.CacheStaleTTL.Duration),
+			Validators:  validators,
+		}
+		storeCache(key, entry)
+
+		return entry, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*cacheEntry), nil
+}
+
+func lookupCache(key string) *cacheEntry {
+	entry, found := cacheStore.Get(key)
+	if !found || time.Now().After(entry.UsableUntil) {
+		return nil
+	}
+
+	return entry
+}
+
+func storeCache(key string, entry *cacheEntry) {
+	cacheStore.Set(key, entry)
+}
+
+func getHoraro(endpoint string) (*HoraroResponse, cacheStatus, error) {
+	entry, status, err := getCached(endpoint, horaroFetcher(endpoint))
+	if err != nil {
+		return nil, status, err
+	}
+
+	horaro := entry.Value.(*HoraroResponse)
+	archiveCurrent(endpoint, horaro)
+
+	return horaro, status, nil
+}
+
+// refreshHoraro fetches the schedule from Horaro even if the cached one is still fresh
+func refreshHoraro(endpoint string) (*HoraroResponse, error) {
+	entry, err := refreshCache(endpoint, horaroFetcher(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	horaro := entry.Value.(*HoraroResponse)
+	archiveCurrent(endpoint, horaro)
+
+	return horaro, nil
+}
+
+// horaroFetcher creates the fetchFunc for a schedule
+func horaroFetcher(endpoint string) fetchFunc {
+	return func(previous *cacheEntry) (interface{}, Validators, error) {
+		log.Printf("Fetching new data for '%s' from Horaro", endpoint)
+
+		validators := Validators{}
+		if previous != nil {
+			validators = previous.Validators
+
+			// Without validators from Horaro, the schedule's own update time still tells whether it changed
+			if validators.ETag == "" && validators.LastModified == "" {
+				updated := previous.Value.(*HoraroResponse).Schedule.Updated
+				validators.LastModified = updated.UTC().Format(http.TimeFormat)
+			}
+		}
+
+		horaro, received, err := FetchHoraro(withHiddenKey(endpoint), validators)
+		if err != nil {
+			// Keep the hidden key out of the logs
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				urlErr.URL = endpoint
+			}
+			return nil, received, err
+		}
+
+		var previousHoraro *HoraroResponse
+		if previous != nil {
+			previousHoraro = previous.Value.(*HoraroResponse)
+		}
+		go notifyScheduleChange(endpoint, previousHoraro, horaro)
+
+		return horaro, received, nil
+	}
+}
+
+func getHoraroApi(endpoint string) (*string, cacheStatus, error) {
+	// Prefix the key so an API response never collides with a schedule of the same URL
+	entry, status, err := getCached("api:"+endpoint, func(previous *cacheEntry) (interface{}, Validators, error) {
+		validators := Validators{}
+		if previous != nil {
+			validators = previous.Validators
+		}
+
+		return FetchHoraroApi(endpoint, validators)
+	})
+	if err != nil {
+		return nil, status, err
+	}
+
+	return entry.Value.(*string), status, nil
+}
+
+// setCacheStatus tells the client whether the response came from the cache and if it's stale
+func setCacheStatus(w http.ResponseWriter, status cacheStatus) {
+	w.Header().Set("X-Cache-Status", string(status))
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// diskFile is the JSON format of a cache entry on disk
+type diskFile struct {
+	Key          string          `json:"key"`
+	Kind         string          `json:"kind"`
+	Value        json.RawMessage `json:"value"`
+	FetchedAt    time.Time       `json:"fetched_at"`
+	FreshUntil   time.Time       `json:"fresh_until"`
+	UsableUntil  time.Time       `json:"usable_until"`
+	RetryAt      time.Time       `json:"retry_at"`
+	ETag         string          `json:"etag"`
+	LastModified string          `json:"last_modified"`
+}
+
+// diskLoaded is an entry read from disk, remembered until the file is modified
+type diskLoaded struct {
+	entry   *cacheEntry
+	modTime time.Time
+}
+
+// diskBackend stores every entry as a JSON file in a directory, so it survives restarts and can be shared
+type diskBackend struct {
+	directory string
+
+	mu     sync.Mutex
+	loaded map[string]diskLoaded
+}
+
+func newDiskBackend(directory string) (*diskBackend, error) {
+	err := os.MkdirAll(directory, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := &diskBackend{
+		directory: directory,
+		loaded:    make(map[string]diskLoaded),
+	}
+
+	go func() {
+		for range time.Tick(cleanupInterval) {
+			backend.removeExpired()
+		}
+	}()
+
+	return backend, nil
+}
+
+func (b *diskBackend) path(key string) string {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return filepath.Join(b.directory, fmt.Sprintf("%016x.json", h.Sum64()))
+}
+
+func (b *diskBackend) Get(key string) (*cacheEntry, bool) {
+	path := b.path(key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		b.forget(key)
+		return nil, false
+	}
+
+	// Decoding a schedule is expensive, so only do it when another process or refresh wrote the file
+	b.mu.Lock()
+	loaded, ok := b.loaded[key]
+	b.mu.Unlock()
+
+	if !ok || !loaded.modTime.Equal(info.ModTime()) {
+		file, err := readDiskFile(path)
+		if err != nil || file.Key != key {
+			return nil, false
+		}
+
+		entry, err := file.entry()
+		if err != nil {
+			log.Printf("Could not decode cache file '%s': %s", path, err.Error())
+			return nil, false
+		}
+
+		loaded = diskLoaded{entry: entry, modTime: info.ModTime()}
+
+		b.mu.Lock()
+		b.loaded[key] = loaded
+		b.mu.Unlock()
+	}
+
+	if time.Now().After(loaded.entry.UsableUntil) {
+		b.Delete(key)
+		return nil, false
+	}
+
+	return loaded.entry, true
+}
+
+func (b *diskBackend) Set(key string, entry *cacheEntry) {
+	file, err := newDiskFile(key, entry)
+	if err != nil {
+		log.Printf("Could not encode cache entry '%s': %s", key, err.Error())
+		return
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		log.Printf("Could not encode cache entry '%s': %s", key, err.Error())
+		return
+	}
+
+	// Write to a temporary file first, so readers never see a partially written entry
+	temp, err := os.CreateTemp(b.directory, "*.tmp")
+	if err != nil {
+		log.Printf("Could not write cache entry '%s': %s", key, err.Error())
+		return
+	}
+
+	path := b.path(key)
+
+	_, err = temp.Write(data)
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		log.Printf("Could not write cache entry '%s': %s", key, err.Error())
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		b.forget(key)
+		return
+	}
+
+	b.mu.Lock()
+	b.loaded[key] = diskLoaded{entry: entry, modTime: info.ModTime()}
+	b.mu.Unlock()
+}
+
+func (b *diskBackend) Delete(key string) {
+	os.Remove(b.path(key))
+	b.forget(key)
+}
+
+func (b *diskBackend) Flush() {
+	paths, _ := filepath.Glob(filepath.Join(b.directory, "*.json"))
+	for _, path := range paths {
+		os.Remove(path)
+	}
+
+	b.mu.Lock()
+	b.loaded = make(map[string]diskLoaded)
+	b.mu.Unlock()
+}
+
+func (b *diskBackend) Entries() map[string]*cacheEntry {
+	paths, _ := filepath.Glob(filepath.Join(b.directory, "*.json"))
+	entries := make(map[string]*cacheEntry)
+
+	for _, path := range paths {
+		file, err := readDiskFile(path)
+		if err != nil {
+			continue
+		}
+
+		if entry, ok := b.Get(file.Key); ok {
+			entries[file.Key] = entry
+		}
+	}
+
+	return entries
+}
+
+func (b *diskBackend) forget(key string) {
+	b.mu.Lock()
+	delete(b.loaded, key)
+	b.mu.Unlock()
+}
+
+// removeExpired deletes the files of entries that are no longer usable
+func (b *diskBackend) removeExpired() {
+	paths, _ := filepath.Glob(filepath.Join(b.directory, "*.json"))
+	now := time.Now()
+
+	for _, path := range paths {
+		file, err := readDiskFile(path)
+		if err != nil || now.After(file.UsableUntil) {
+			os.Remove(path)
+			if err == nil {
+				b.forget(file.Key)
+			}
+		}
+	}
+}
+
+func readDiskFile(path string) (*diskFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file diskFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+func newDiskFile(key string, entry *cacheEntry) (*diskFile, error) {
+	file := &diskFile{
+		Key:          key,
+		FetchedAt:    entry.FetchedAt,
+		FreshUntil:   entry.FreshUntil,
+		UsableUntil:  entry.UsableUntil,
+		RetryAt:      entry.RetryAt,
+		ETag:         entry.Validators.ETag,
+		LastModified: entry.Validators.LastModified,
+	}
+
+	switch entry.Value.(type) {
+	case *HoraroResponse:
+		file.Kind = "schedule"
+	case *string:
+		file.Kind = "api"
+	default:
+		return nil, fmt.Errorf("Can not store a %T on disk", entry.Value)
+	}
+
+	value, err := json.Marshal(entry.Value)
+	if err != nil {
+		return nil, err
+	}
+	file.Value = value
+
+	return file, nil
+}
+
+func (file *diskFile) entry() (*cacheEntry, error) {
+	entry := &cacheEntry{
+		FetchedAt:   file.FetchedAt,
+		FreshUntil:  file.FreshUntil,
+		UsableUntil: file.UsableUntil,
+		RetryAt:     file.RetryAt,
+		Validators: Validators{
+			ETag:         file.ETag,
+			LastModified: file.LastModified,
+		},
+	}
+
+	switch file.Kind {
+	case "schedule":
+		var horaro HoraroResponse
+		err := json.Unmarshal(file.Value, &horaro)
+		entry.Value = &horaro
+		return entry, err
+	case "api":
+		var body string
+		err := json.Unmarshal(file.Value, &body)
+		entry.Value = &body
+		return entry, err
+	}
+
+	return nil, fmt.Errorf("Unknown cache entry kind '%s'", file.Kind)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "sync"
+
+// scheduleListener is called when a schedule is fetched whose update time differs from the cached one.
+// previous is nil when there was no cached schedule.
+type scheduleListener func(endpoint string, previous, current *HoraroResponse)
+
+var listenersMutex sync.RWMutex
+var scheduleListeners []scheduleListener
+
+// onScheduleChange registers a listener for changed schedules
+func onScheduleChange(listener scheduleListener) {
+	listenersMutex.Lock()
+	scheduleListeners = append(scheduleListeners, listener)
+	listenersMutex.Unlock()
+}
+
+// notifyScheduleChange calls the listeners if the update time of the schedule changed
+func notifyScheduleChange(endpoint string, previous, current *HoraroResponse) {
+	if previous != nil && previous.Schedule.Updated.Equal(current.Schedule.Updated) {
+		return
+	}
+
+	listenersMutex.RLock()
+	listeners := scheduleListeners
+	listenersMutex.RUnlock()
+
+	for _, listener := range listeners {
+		listener(endpoint, previous, current)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ColumnMapping maps the fields of a run to the names of the Horaro columns they are read from.
+// The first column of the list that exists in a schedule is used, names are compared ignoring casing.
+type ColumnMapping map[string][]string
+
+// defaultColumns are the column names of the ESA schedule template
+var defaultColumns = ColumnMapping{
+	"game":     {"Game"},
+	"players":  {"Player(s)"},
+	"platform": {"Platform"},
+	"category": {"Category"},
+	"note":     {"Note"},
+	"layout":   {"Layout"},
+	"info":     {"Info"},
+	"id":       {"ID"},
+}
+
+// validate checks that only known fields are mapped
+func (mapping ColumnMapping) validate() error {
+	for field, names := range mapping {
+		if _, ok := defaultColumns[field]; !ok {
+			return fmt.Errorf("Unknown run field '%s' in column mapping", field)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("No columns for run field '%s' in column mapping", field)
+		}
+	}
+
+	return nil
+}
+
+// columnMappingFor combines the default columns with the ones configured for all schedules, for the organization
+// and for the schedule, the most specific mapping of a field wins
+func columnMappingFor(horaro *HoraroResponse) ColumnMapping {
+	organization := strings.ToLower(horaro.Schedule.Event.Slug)
+	schedule := scheduleKey(horaro.Schedule.Event.Slug, horaro.Schedule.Slug)
+
+	mapping := ColumnMapping{}
+	for _, layer := range []ColumnMapping{defaultColumns, config.Columns, config.ScheduleColumns[organization], config.ScheduleColumns[schedule]} {
+		for field, names := range layer {
+			mapping[field] = names
+		}
+	}
+
+	return mapping
+}
+
+// Index returns the index of the first column of the field that exists in the columns, -1 if none does
+func (mapping ColumnMapping) Index(field string, columns []string) int {
+	for _, name := range mapping[field] {
+		if index := indexOf(name, columns, strings.EqualFold); index > -1 {
+			return index
+		}
+	}
+
+	return -1
+}
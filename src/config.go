@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the proxy, read from an optional JSON file and environment variables
+type Config struct {
+	// HoraroBaseURL is the upstream used for schedules that are requested by slug
+	HoraroBaseURL string `json:"horaro_base_url"`
+	// AllowedHosts are the hostnames the proxy is allowed to fetch from
+	AllowedHosts []string `json:"allowed_hosts"`
+	// AllowHTTP allows fetching from plain HTTP upstreams, e.g. a local Horaro stand-in
+	AllowHTTP bool `json:"allow_http"`
+	// Organization is the default organization slug for schedules requested by slug
+	Organization string `json:"organization"`
+	// CacheTTL is how long a fetched schedule is served without refreshing it
+	CacheTTL Duration `json:"cache_ttl"`
+	// CacheStaleTTL is how long after CacheTTL a schedule is still served while refreshing or when Horaro is down
+	CacheStaleTTL Duration `json:"cache_stale_ttl"`
+	// CacheBackend is where fetched data is cached, either "memory" or "disk"
+	CacheBackend string `json:"cache_backend"`
+	// CacheDirectory is the directory used by the disk cache backend
+	CacheDirectory string `json:"cache_directory"`
+	// ArchiveBackend is where the versions of schedules are kept, either "memory" or "disk"
+	ArchiveBackend string `json:"archive_backend"`
+	// ArchiveDirectory is the directory used by the disk archive backend
+	ArchiveDirectory string `json:"archive_directory"`
+	// ArchiveVersions is the number of versions kept of every schedule, older ones are removed
+	ArchiveVersions int `json:"archive_versions"`
+	// DelaysFile is where the delays set by the operators are saved, they are only kept in memory when it's empty
+	DelaysFile string `json:"delays_file"`
+	// Columns overrides the Horaro columns that the fields of runs are read from, for all schedules
+	Columns ColumnMapping `json:"columns"`
+	// ScheduleColumns overrides the columns for an organization ("esa") or a schedule ("esa/2024-one")
+	ScheduleColumns map[string]ColumnMapping `json:"schedule_columns"`
+	// HoraroHiddenKeys are the Horaro hidden keys by schedule ("esa/2024-one"), to fetch the hidden columns
+	HoraroHiddenKeys map[string]string `json:"horaro_hidden_keys"`
+	// HiddenColumnsKey lets requests that send it in the X-Hidden-Columns-Key header see the hidden columns
+	HiddenColumnsKey string `json:"hidden_columns_key"`
+	// AdminToken is the bearer token for the admin routes, they are disabled when it's empty
+	AdminToken string `json:"admin_token"`
+	// Prewarm are the schedules (slugs or URLs) that are kept fresh in the background
+	Prewarm []string `json:"prewarm"`
+	// PrewarmInterval is how often the pre-warmed schedules are refreshed
+	PrewarmInterval Duration `json:"prewarm_interval"`
+	// Webhooks are called when a schedule changes on Horaro
+	Webhooks []WebhookConfig `json:"webhooks"`
+	// WebhookSecret signs the webhooks that don't have their own secret
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+// WebhookConfig is a URL that receives the changes of a schedule
+type WebhookConfig struct {
+	// Schedule is the slug or URL of the schedule
+	Schedule string `json:"schedule"`
+	URL      string `json:"url"`
+	// Secret is the key of the HMAC signature, WebhookSecret is used when it's empty
+	Secret string `json:"secret"`
+}
+
+// Duration is a time.Duration that is written as a string like "10m" in the config file
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses durations in the format of time.ParseDuration
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+
+	d.Duration, err = time.ParseDuration(value)
+	return err
+}
+
+var config = defaultConfig()
+
+func defaultConfig() *Config {
+	return &Config{
+		HoraroBaseURL:    "https://horaro.org",
+		Organization:     "esa",
+		CacheTTL:         Duration{10 * time.Minute},
+		CacheStaleTTL:    Duration{24 * time.Hour},
+		CacheBackend:     "memory",
+		CacheDirectory:   "cache",
+		ArchiveBackend:   "disk",
+		ArchiveDirectory: "archive",
+		ArchiveVersions:  50,
+		PrewarmInterval:  Duration{time.Minute},
+	}
+}
+
+// LoadConfig reads the file in CONFIG_FILE (if set) and applies the environment variables on top of it
+func LoadConfig() (*Config, error) {
+	cfg := defaultConfig()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		err = json.NewDecoder(file).Decode(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("Can not parse config file '%s': %w", path, err)
+		}
+	}
+
+	if value := os.Getenv("HORARO_BASE_URL"); value != "" {
+		cfg.HoraroBaseURL = value
+	}
+	if value := os.Getenv("HORARO_ALLOWED_HOSTS"); value != "" {
+		cfg.AllowedHosts = splitList(value)
+	}
+	if value := os.Getenv("HORARO_ALLOW_HTTP"); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid HORARO_ALLOW_HTTP '%s': %w", value, err)
+		}
+		cfg.AllowHTTP = allow
+	}
+	if value := os.Getenv("HORARO_ORGANIZATION"); value != "" {
+		cfg.Organization = value
+	}
+	if err := durationFromEnv("CACHE_TTL", &cfg.CacheTTL); err != nil {
+		return nil, err
+	}
+	if err := durationFromEnv("CACHE_STALE_TTL", &cfg.CacheStaleTTL); err != nil {
+		return nil, err
+	}
+	if value := os.Getenv("CACHE_BACKEND"); value != "" {
+		cfg.CacheBackend = value
+	}
+	if value := os.Getenv("CACHE_DIRECTORY"); value != "" {
+		cfg.CacheDirectory = value
+	}
+	if value := os.Getenv("ARCHIVE_BACKEND"); value != "" {
+		cfg.ArchiveBackend = value
+	}
+	if value := os.Getenv("ARCHIVE_DIRECTORY"); value != "" {
+		cfg.ArchiveDirectory = value
+	}
+	if value := os.Getenv("ARCHIVE_VERSIONS"); value != "" {
+		versions, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ARCHIVE_VERSIONS '%s': %w", value, err)
+		}
+		cfg.ArchiveVersions = versions
+	}
+	if value := os.Getenv("DELAYS_FILE"); value != "" {
+		cfg.DelaysFile = value
+	}
+	if value := os.Getenv("HIDDEN_COLUMNS_KEY"); value != "" {
+		cfg.HiddenColumnsKey = value
+	}
+	if value := os.Getenv("ADMIN_TOKEN"); value != "" {
+		cfg.AdminToken = value
+	}
+	if value := os.Getenv("PREWARM_SCHEDULES"); value != "" {
+		cfg.Prewarm = splitList(value)
+	}
+	if err := durationFromEnv("PREWARM_INTERVAL", &cfg.PrewarmInterval); err != nil {
+		return nil, err
+	}
+	if value := os.Getenv("WEBHOOK_SECRET"); value != "" {
+		cfg.WebhookSecret = value
+	}
+
+	return cfg, cfg.validate()
+}
+
+// validate checks the config and fills in the values that are derived from others
+func (cfg *Config) validate() error {
+	cfg.HoraroBaseURL = strings.TrimSuffix(cfg.HoraroBaseURL, "/")
+
+	base, err := url.Parse(cfg.HoraroBaseURL)
+	if err != nil || base.Hostname() == "" {
+		return fmt.Errorf("Invalid Horaro base URL '%s'", cfg.HoraroBaseURL)
+	}
+	if base.Scheme != "https" && !(base.Scheme == "http" && cfg.AllowHTTP) {
+		return errors.New("Horaro base URL must use HTTPS unless HTTP is allowed")
+	}
+
+	// The base URL is always allowed, otherwise slugs could never be fetched
+	if indexOf(base.Hostname(), cfg.AllowedHosts, strings.EqualFold) == -1 {
+		cfg.AllowedHosts = append(cfg.AllowedHosts, base.Hostname())
+	}
+
+	cfg.Organization = strings.Trim(cfg.Organization, "/")
+	if cfg.Organization == "" {
+		return errors.New("Organization can not be empty")
+	}
+
+	if cfg.CacheTTL.Duration <= 0 {
+		return errors.New("Cache TTL must be positive")
+	}
+	if cfg.CacheStaleTTL.Duration < 0 {
+		return errors.New("Cache stale TTL can not be negative")
+	}
+	if cfg.PrewarmInterval.Duration <= 0 {
+		return errors.New("Pre-warm interval must be positive")
+	}
+	if cfg.ArchiveVersions <= 0 {
+		return errors.New("Number of archived versions must be positive")
+	}
+
+	if err := cfg.Columns.validate(); err != nil {
+		return err
+	}
+	// The keys are matched with the lowercase slugs of schedules
+	scheduleColumns := make(map[string]ColumnMapping, len(cfg.ScheduleColumns))
+	for key, mapping := range cfg.ScheduleColumns {
+		if err := mapping.validate(); err != nil {
+			return fmt.Errorf("Invalid columns of '%s': %w", key, err)
+		}
+		scheduleColumns[strings.ToLower(strings.Trim(key, "/"))] = mapping
+	}
+	cfg.ScheduleColumns = scheduleColumns
+
+	hiddenKeys := make(map[string]string, len(cfg.HoraroHiddenKeys))
+	for key, hiddenKey := range cfg.HoraroHiddenKeys {
+		hiddenKeys[strings.ToLower(strings.Trim(key, "/"))] = hiddenKey
+	}
+	cfg.HoraroHiddenKeys = hiddenKeys
+
+	for i, webhook := range cfg.Webhooks {
+		if webhook.Schedule == "" {
+			return fmt.Errorf("Webhook %d has no schedule", i)
+		}
+
+		target, err := url.Parse(webhook.URL)
+		if err != nil || target.Host == "" || (target.Scheme != "https" && target.Scheme != "http") {
+			return fmt.Errorf("Invalid URL '%s' of webhook %d", webhook.URL, i)
+		}
+
+		if webhook.Secret == "" {
+			if cfg.WebhookSecret == "" {
+				return fmt.Errorf("Webhook %d has no secret and there is no webhook secret", i)
+			}
+			cfg.Webhooks[i].Secret = cfg.WebhookSecret
+		}
+	}
+
+	return nil
+}
+
+// durationFromEnv overrides the duration with the environment variable if it's set
+func durationFromEnv(name string, duration *Duration) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("Invalid %s '%s': %w", name, value, err)
+	}
+	duration.Duration = parsed
+
+	return nil
+}
+
+// splitList splits a comma separated list and drops the empty values
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// csvTimeFormat is a date-time format that spreadsheet applications recognize
+const csvTimeFormat = "2006-01-02 15:04:05"
+
+var csvHeader = []string{"Start", "End", "Length", "Game", "Category", "Platform", "Players", "Layout", "Note", "ID"}
+
+// formatLength formats seconds as H:MM:SS
+func formatLength(seconds int) string {
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// scheduleLocation is the time zone of the schedule, or UTC when Horaro's time zone is unknown
+func scheduleLocation(schedule scheduleData) *time.Location {
+	location, err := time.LoadLocation(schedule.Meta.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return location
+}
+
+// RenderCSV renders a row per run separated by comma, the time columns are in the given time zone
+func RenderCSV(schedule scheduleData, comma rune, location *time.Location) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writer := csv.NewWriter(buf)
+	writer.Comma = comma
+	// Line endings of RFC 4180
+	writer.UseCRLF = true
+
+	err := writer.Write(csvHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, run := range schedule.Data {
+		start := run.Start().In(location)
+		end := start.Add(time.Second * time.Duration(run.Length))
+
+		err = writer.Write([]string{
+			start.Format(csvTimeFormat),
+			end.Format(csvTimeFormat),
+			formatLength(run.Length),
+			stringValue(run.Game),
+			stringValue(run.Category),
+			stringValue(run.Platform),
+			strings.Join(run.Players, ", "),
+			stringValue(run.Layout),
+			stringValue(run.Note),
+			stringValue(run.ID),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+
+	return buf.Bytes(), writer.Error()
+}
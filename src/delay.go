@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// delayMark shifts a run and the runs after it, until the next marked run
+type delayMark struct {
+	// Run is the ID of the run as in the schedule diffs
+	Run string `json:"run"`
+	// Offset is the number of seconds the run starts later than scheduled
+	Offset int       `json:"offset"`
+	SetAt  time.Time `json:"set_at"`
+}
+
+// delayRequest is the body of the admin route setting a delay
+type delayRequest struct {
+	Run       string     `json:"run"`
+	StartedAt *time.Time `json:"started_at"`
+	Offset    *int       `json:"offset"`
+}
+
+var delaysMutex sync.RWMutex
+
+// delaysFileMutex keeps the delays file from being written by two saves at once
+var delaysFileMutex sync.Mutex
+
+// scheduleDelays are the delay marks by endpoint
+var scheduleDelays = map[string][]delayMark{}
+
+// loadDelays reads the delays saved in the file, a missing file means there are none
+func loadDelays(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	delaysMutex.Lock()
+	defer delaysMutex.Unlock()
+
+	return json.Unmarshal(data, &scheduleDelays)
+}
+
+// saveDelays writes the delays to the configured file, so they survive restarts
+func saveDelays() {
+	if config.DelaysFile == "" {
+		return
+	}
+
+	// Hold the file lock from reading to writing the delays, so an older save never overwrites a newer one
+	delaysFileMutex.Lock()
+	defer delaysFileMutex.Unlock()
+
+	delaysMutex.RLock()
+	data, err := json.Marshal(scheduleDelays)
+	delaysMutex.RUnlock()
+	if err != nil {
+		log.Printf("Could not save the delays to '%s': %s", config.DelaysFile, err.Error())
+		return
+	}
+
+	// Write to a temporary file first, so a crash never leaves a partially written file
+	temp, err := os.CreateTemp(filepath.Dir(config.DelaysFile), "*.tmp")
+	if err != nil {
+		log.Printf("Could not save the delays to '%s': %s", config.DelaysFile, err.Error())
+		return
+	}
+
+	err = temp.Chmod(0o644)
+	if err == nil {
+		_, err = temp.Write(data)
+	}
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), config.DelaysFile)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		log.Printf("Could not save the delays to '%s': %s", config.DelaysFile, err.Error())
+	}
+}
+
+func getDelays(endpoint string) []delayMark {
+	delaysMutex.RLock()
+	defer delaysMutex.RUnlock()
+
+	return append([]delayMark{}, scheduleDelays[endpoint]...)
+}
+
+// setDelay adds the mark, replacing an earlier mark of the same run
+func setDelay(endpoint string, mark delayMark) {
+	delaysMutex.Lock()
+	marks := []delayMark{}
+	for _, existing := range scheduleDelays[endpoint] {
+		if existing.Run != mark.Run {
+			marks = append(marks, existing)
+		}
+	}
+	scheduleDelays[endpoint] = append(marks, mark)
+	delaysMutex.Unlock()
+
+	saveDelays()
+	publishDelays(endpoint)
+}
+
+func clearDelays(endpoint string) {
+	delaysMutex.Lock()
+	delete(scheduleDelays, endpoint)
+	delaysMutex.Unlock()
+
+	saveDelays()
+	publishDelays(endpoint)
+}
+
+// delaysVersion changes whenever the delays of the schedule change, for ETags
+func delaysVersion(endpoint string) string {
+	version := ""
+	for _, mark := range getDelays(endpoint) {
+		version += fmt.Sprintf(" %s:%d", mark.Run, mark.Offset)
+	}
+
+	return version
+}
+
+// findRun returns the index of the run with the ID as in the schedule diffs or in the ID column, -1 if there is none
+func findRun(schedule scheduleData, id string) int {
+	ids := RunUIDs(schedule.Data)
+	for i := range ids {
+		if ids[i] == id || ids[i] == "id-"+id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// EstimatedStarts applies the delays to the scheduled start of every run, nil when there are no delays
+func EstimatedStarts(schedule scheduleData, marks []delayMark) []time.Time {
+	if len(marks) == 0 {
+		return nil
+	}
+
+	offsets := map[string]int{}
+	for _, mark := range marks {
+		offsets[mark.Run] = mark.Offset
+	}
+
+	offset := 0
+	starts := make([]time.Time, len(schedule.Data))
+	for i, id := range RunUIDs(schedule.Data) {
+		if markOffset, ok := offsets[id]; ok {
+			offset = markOffset
+		}
+
+		starts[i] = schedule.Data[i].Scheduled.Add(time.Duration(offset) * time.Second)
+	}
+
+	return starts
+}
+
+// applyEstimates sets the estimated start of the runs, unless there are no estimates
+func (list *scheduleData) applyEstimates(starts []time.Time) {
+	for i := range starts {
+		start := starts[i]
+		list.Data[i].Estimated = &start
+	}
+}
+
+// TransformDelayedHoraro transforms the schedule and applies the delays set by the operators
+func TransformDelayedHoraro(endpoint string, horaro *HoraroResponse) scheduleData {
+	schedule := TransformHoraro(horaro)
+	schedule.applyEstimates(EstimatedStarts(schedule, getDelays(endpoint)))
+
+	return schedule
+}
+
+func adminDelayHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := requestedEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"endpoint": endpoint,
+		"data":     getDelays(endpoint),
+	})
+}
+
+// adminSetDelayHandler marks when a run actually started, or sets the offset from a run (by default the live or next
+// one) onwards
+func adminSetDelayHandler(w http.ResponseWriter, r *http.Request) {
+	var request delayRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || (request.StartedAt == nil) == (request.Offset == nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "Expected a JSON body with either 'started_at' or 'offset'",
+		})
+		return
+	}
+
+	endpoint, horaro, ok := requestedSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	schedule := TransformDelayedHoraro(endpoint, horaro)
+
+	index := -1
+	if request.Run != "" {
+		index = findRun(schedule, request.Run)
+	} else {
+		current, next := RunAt(schedule, time.Now())
+		index = current
+		if index == -1 {
+			index = next
+		}
+	}
+
+	if index == -1 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "Could not find the run, pass its ID as 'run'",
+		})
+		return
+	}
+
+	mark := delayMark{Run: RunUIDs(schedule.Data)[index], SetAt: time.Now()}
+	if request.StartedAt != nil {
+		mark.Offset = int(request.StartedAt.Sub(schedule.Data[index].Scheduled) / time.Second)
+	} else {
+		mark.Offset = *request.Offset
+	}
+
+	setDelay(endpoint, mark)
+	log.Printf("Delaying '%s' from run '%s' by %ds", endpoint, mark.Run, mark.Offset)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"endpoint": endpoint,
+		"data":     getDelays(endpoint),
+	})
+}
+
+func adminClearDelayHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := requestedEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	clearDelays(endpoint)
+	log.Printf("Cleared the delays of '%s'", endpoint)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEstimatedStarts(t *testing.T) {
+	schedule := diffTestSchedule([]string{"a", "b", "c"}, []int{0, 1, 2})
+
+	// want are the seconds every run starts later than scheduled, nil when there are no estimates
+	tests := []struct {
+		name  string
+		marks []delayMark
+		want  []int
+	}{
+		{"no delays", nil, nil},
+		{"from the first run", []delayMark{{Run: "id-a", Offset: 300}}, []int{300, 300, 300}},
+		{"from a later run", []delayMark{{Run: "id-b", Offset: 600}}, []int{0, 600, 600}},
+		{"until the next mark", []delayMark{{Run: "id-a", Offset: 300}, {Run: "id-c", Offset: -120}}, []int{300, 300, -120}},
+		{"back on schedule", []delayMark{{Run: "id-a", Offset: 300}, {Run: "id-b", Offset: 0}}, []int{300, 0, 0}},
+		{"unknown run", []delayMark{{Run: "id-x", Offset: 300}}, []int{0, 0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			starts := EstimatedStarts(schedule, test.marks)
+
+			var got []int
+			for i, start := range starts {
+				got = append(got, int(start.Sub(schedule.Data[i].Scheduled)/time.Second))
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("EstimatedStarts(%+v) = %v, want %v", test.marks, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// diffRun is a run that was added to or removed from a schedule, the runs are in the format of the API version
+type diffRun struct {
+	ID  string      `json:"id"`
+	Run interface{} `json:"run"`
+}
+
+// runChange is a run that is in both versions of a schedule, but changed
+type runChange struct {
+	ID string `json:"id"`
+	// Fields are the JSON names of the changed fields
+	Fields []string    `json:"fields"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+}
+
+// runMove is a run that changed its place in the order of the schedule
+type runMove struct {
+	ID       string      `json:"id"`
+	OldIndex int         `json:"old_index"`
+	NewIndex int         `json:"new_index"`
+	Old      interface{} `json:"old"`
+	New      interface{} `json:"new"`
+}
+
+// runSerializer serializes a run with its ID in the format of an API version
+type runSerializer func(run runData, id string) interface{}
+
+// timingFields are the JSON names of the fields that follow from the place of a run in the schedule, they aren't
+// reported as edits
+var timingFields = map[string]bool{
+	"scheduled": true,
+	"estimated": true,
+	"start":     true,
+	"end":       true,
+	"delay":     true,
+	"status":    true,
+	"index":     true,
+}
+
+// ScheduleDiff is the difference between two versions of a schedule.
+// A run can be edited and also reordered or retimed.
+type ScheduleDiff struct {
+	Added   []diffRun `json:"added"`
+	Removed []diffRun `json:"removed"`
+	// Reordered are the runs that moved relative to the other runs
+	Reordered []runMove `json:"reordered"`
+	// Retimed are the runs that kept their place in the order, but are scheduled at a different time
+	Retimed []runChange `json:"retimed"`
+	// Edited are the runs of which anything but the scheduled time changed
+	Edited []runChange `json:"edited"`
+}
+
+// Empty reports whether there are no differences
+func (diff ScheduleDiff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Reordered) == 0 &&
+		len(diff.Retimed) == 0 && len(diff.Edited) == 0
+}
+
+// changedFields lists the JSON names of the fields that differ between the runs, except the timing fields
+func changedFields(old, new interface{}) []string {
+	fields := []string{}
+
+	oldValue := reflect.ValueOf(old)
+	newValue := reflect.ValueOf(new)
+	runType := oldValue.Type()
+
+	for i := 0; i < runType.NumField(); i++ {
+		name := strings.Split(runType.Field(i).Tag.Get("json"), ",")[0]
+		if timingFields[name] {
+			continue
+		}
+
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
+
+// keptOrder returns which runs are part of the longest subsequence that kept its order, given the old index of
+// every run in the new order. The others are the fewest runs that have to move. Of equally long subsequences the
+// one with the most runs at an unchanged index is taken, so moving a run doesn't reorder the runs it passed.
+// When two neighbouring runs swap, only one of them has to move: the other one kept its place relative to the
+// rest of the schedule and is only retimed.
+func keptOrder(oldIndices, newIndices []int) []bool {
+	length := make([]int, len(oldIndices))
+	unchanged := make([]int, len(oldIndices))
+	previous := make([]int, len(oldIndices))
+
+	last := -1
+	for i := range oldIndices {
+		same := 0
+		if oldIndices[i] == newIndices[i] {
+			same = 1
+		}
+
+		length[i], unchanged[i], previous[i] = 1, same, -1
+		for j := 0; j < i; j++ {
+			if oldIndices[j] >= oldIndices[i] {
+				continue
+			}
+			if length[j]+1 > length[i] || (length[j]+1 == length[i] && unchanged[j]+same > unchanged[i]) {
+				length[i], unchanged[i], previous[i] = length[j]+1, unchanged[j]+same, j
+			}
+		}
+
+		if last == -1 || length[i] > length[last] || (length[i] == length[last] && unchanged[i] > unchanged[last]) {
+			last = i
+		}
+	}
+
+	kept := make([]bool, len(oldIndices))
+	for i := last; i != -1; i = previous[i] {
+		kept[i] = true
+	}
+
+	return kept
+}
+
+// DiffSchedules compares the runs of two versions of a schedule, the runs are reported in the format of API v2.
+// Runs are matched by their ID column, or by game and category when they don't have an ID.
+func DiffSchedules(old, new scheduleData) ScheduleDiff {
+	return diffSchedules(old, new, func(run runData, id string) interface{} {
+		return run.V2()
+	})
+}
+
+// DiffSchedulesV3 compares the runs of two versions of a schedule, the runs are reported in the format of API v3
+func DiffSchedulesV3(old, new scheduleData, at time.Time) ScheduleDiff {
+	return diffSchedules(old, new, func(run runData, id string) interface{} {
+		return run.V3(id, at)
+	})
+}
+
+func diffSchedules(old, new scheduleData, serialize runSerializer) ScheduleDiff {
+	diff := ScheduleDiff{
+		Added:     []diffRun{},
+		Removed:   []diffRun{},
+		Reordered: []runMove{},
+		Retimed:   []runChange{},
+		Edited:    []runChange{},
+	}
+
+	oldIDs := RunUIDs(old.Data)
+	newIDs := RunUIDs(new.Data)
+
+	oldIndices := make(map[string]int, len(old.Data))
+	for i, id := range oldIDs {
+		oldIndices[id] = i
+	}
+
+	// The runs in both versions, in the new order
+	var common, commonOld []int
+	newRuns := make(map[string]bool, len(new.Data))
+	for i, run := range new.Data {
+		id := newIDs[i]
+		newRuns[id] = true
+
+		index, ok := oldIndices[id]
+		if !ok {
+			diff.Added = append(diff.Added, diffRun{ID: id, Run: serialize(run, id)})
+			continue
+		}
+
+		common = append(common, i)
+		commonOld = append(commonOld, index)
+	}
+
+	inOrder := keptOrder(commonOld, common)
+	for k, i := range common {
+		id := newIDs[i]
+		previous, run := serialize(old.Data[commonOld[k]], id), serialize(new.Data[i], id)
+
+		if !inOrder[k] {
+			diff.Reordered = append(diff.Reordered, runMove{ID: id, OldIndex: commonOld[k], NewIndex: i, Old: previous, New: run})
+		} else if !old.Data[commonOld[k]].Scheduled.Equal(new.Data[i].Scheduled) {
+			diff.Retimed = append(diff.Retimed, runChange{ID: id, Fields: []string{"scheduled"}, Old: previous, New: run})
+		}
+
+		if fields := changedFields(previous, run); len(fields) > 0 {
+			diff.Edited = append(diff.Edited, runChange{ID: id, Fields: fields, Old: previous, New: run})
+		}
+	}
+
+	for i, run := range old.Data {
+		if !newRuns[oldIDs[i]] {
+			diff.Removed = append(diff.Removed, diffRun{ID: oldIDs[i], Run: serialize(run, oldIDs[i])})
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// scheduleDiffHandler compares the schedule with the previous version, or the version at the time in ?since=
+func scheduleDiffHandler(w http.ResponseWriter, r *http.Request) {
+	// Ignore Options request from CORS
+	if r.Method == http.MethodOptions {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	params := newQueryParams(r)
+	since := params.Time("since")
+	if !params.Valid(w) {
+		return
+	}
+
+	endpoint, horaro, ok := requestedSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	var previous *HoraroResponse
+	if since == nil {
+		previous = snapshotBefore(endpoint, horaro.Schedule.Updated)
+	} else {
+		previous = snapshotAt(endpoint, *since)
+	}
+
+	if previous == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "No earlier version of the schedule is known",
+		})
+		return
+	}
+
+	now := time.Now()
+	maxAge := 60
+	etag := previous.Schedule.Updated.UTC().Format(time.RFC3339Nano) + " " + horaro.Schedule.Updated.UTC().Format(time.RFC3339Nano)
+
+	// The runs of v3 include the delays and their status, as in the schedule route
+	v3 := mux.Vars(r)["version"] == "v3"
+	var schedule scheduleData
+	if v3 {
+		schedule = TransformDelayedHoraro(endpoint, horaro)
+		maxAge = statusMaxAge(schedule, now, maxAge)
+		etag += delaysVersion(endpoint) + runStatusVersion(schedule, now)
+	} else {
+		schedule = TransformHoraro(horaro)
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", maxAge))
+	if checkETag(w, r, weakETag(etag)) {
+		return
+	}
+
+	var meta interface{}
+	var diff ScheduleDiff
+	if v3 {
+		meta = schedule.Meta.V3()
+		diff = DiffSchedulesV3(TransformDelayedHoraro(endpoint, previous), schedule, now)
+	} else {
+		meta = schedule.Meta.V2()
+		diff = DiffSchedules(TransformHoraro(previous), schedule)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"meta": meta,
+		"from": JSONTime{previous.Schedule.Updated},
+		"to":   JSONTime{horaro.Schedule.Updated},
+		"data": diff,
+	})
+}
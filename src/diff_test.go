@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeptOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		oldIndices []int
+		newIndices []int
+		want       []bool
+	}{
+		{"empty", []int{}, []int{}, []bool{}},
+		{"unchanged", []int{0, 1, 2}, []int{0, 1, 2}, []bool{true, true, true}},
+		{"swap", []int{1, 0, 2}, []int{0, 1, 2}, []bool{true, false, true}},
+		{"move to front", []int{3, 0, 1, 2}, []int{0, 1, 2, 3}, []bool{false, true, true, true}},
+		{"move to back", []int{1, 2, 3, 0}, []int{0, 1, 2, 3}, []bool{true, true, true, false}},
+		{"insert", []int{0, 1}, []int{0, 2}, []bool{true, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := keptOrder(test.oldIndices, test.newIndices)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("keptOrder(%v, %v) = %v, want %v", test.oldIndices, test.newIndices, got, test.want)
+			}
+		})
+	}
+}
+
+// diffTestSchedule makes a schedule of hour long runs with the IDs, starting at the offsets in hours
+func diffTestSchedule(ids []string, offsets []int) scheduleData {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	schedule := scheduleData{}
+	for i := range ids {
+		id, game := ids[i], "Game "+ids[i]
+		schedule.Data = append(schedule.Data, runData{
+			Index:     i,
+			Length:    3600,
+			Scheduled: start.Add(time.Duration(offsets[i]) * time.Hour),
+			Game:      &game,
+			ID:        &id,
+		})
+	}
+
+	return schedule
+}
+
+func TestDiffSchedules(t *testing.T) {
+	type diffIDs struct {
+		added, removed, reordered, retimed, edited []string
+	}
+
+	tests := []struct {
+		name string
+		old  scheduleData
+		new  scheduleData
+		want diffIDs
+	}{
+		{
+			name: "unchanged",
+			old:  diffTestSchedule([]string{"a", "b", "c"}, []int{0, 1, 2}),
+			new:  diffTestSchedule([]string{"a", "b", "c"}, []int{0, 1, 2}),
+			want: diffIDs{},
+		},
+		{
+			name: "swap",
+			old:  diffTestSchedule([]string{"a", "b", "c"}, []int{0, 1, 2}),
+			new:  diffTestSchedule([]string{"b", "a", "c"}, []int{0, 1, 2}),
+			want: diffIDs{reordered: []string{"id-a"}, retimed: []string{"id-b"}},
+		},
+		{
+			name: "insert",
+			old:  diffTestSchedule([]string{"a", "b", "c"}, []int{0, 1, 2}),
+			new:  diffTestSchedule([]string{"a", "x", "b", "c"}, []int{0, 1, 2, 3}),
+			want: diffIDs{added: []string{"id-x"}, retimed: []string{"id-b", "id-c"}},
+		},
+		{
+			name: "retime",
+			old:  diffTestSchedule([]string{"a", "b", "c"}, []int{0, 1, 2}),
+			new:  diffTestSchedule([]string{"a", "b", "c"}, []int{0, 1, 3}),
+			want: diffIDs{retimed: []string{"id-c"}},
+		},
+		{
+			name: "remove",
+			old:  diffTestSchedule([]string{"a", "b", "c"}, []int{0, 1, 2}),
+			new:  diffTestSchedule([]string{"a", "c"}, []int{0, 2}),
+			want: diffIDs{removed: []string{"id-b"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := DiffSchedules(test.old, test.new)
+
+			got := diffIDs{}
+			for _, run := range diff.Added {
+				got.added = append(got.added, run.ID)
+			}
+			for _, run := range diff.Removed {
+				got.removed = append(got.removed, run.ID)
+			}
+			for _, move := range diff.Reordered {
+				got.reordered = append(got.reordered, move.ID)
+			}
+			for _, change := range diff.Retimed {
+				got.retimed = append(got.retimed, change.ID)
+			}
+			for _, change := range diff.Edited {
+				got.edited = append(got.edited, change.ID)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("DiffSchedules() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// strongETag creates an ETag for a response that is byte-for-byte identical while the ETag is the same
+func strongETag(body []byte) string {
+	return `"` + hash(string(body)) + `"`
+}
+
+// weakETag creates an ETag for a response that is only semantically identical while the ETag is the same
+func weakETag(version string) string {
+	return `W/"` + hash(version) + `"`
+}
+
+// parseETags splits an If-None-Match header into its entity tags, "*" is returned as is
+func parseETags(header string) []string {
+	tags := []string{}
+	rest := strings.TrimSpace(header)
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+
+		if rest[0] == '*' {
+			tags = append(tags, "*")
+			rest = rest[1:]
+			continue
+		}
+
+		weak := strings.HasPrefix(rest, "W/")
+		if weak {
+			rest = rest[2:]
+		}
+
+		if !strings.HasPrefix(rest, `"`) {
+			// Malformed entity tag, skip to the next one
+			if i := strings.IndexByte(rest, ','); i >= 0 {
+				rest = rest[i:]
+				continue
+			}
+			break
+		}
+
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			break
+		}
+
+		tag := rest[:end+2]
+		if weak {
+			tag = "W/" + tag
+		}
+		tags = append(tags, tag)
+		rest = rest[end+2:]
+	}
+
+	return tags
+}
+
+// etagMatches compares the If-None-Match header with the ETag using the weak comparison of RFC 9110
+func etagMatches(header, etag string) bool {
+	for _, tag := range parseETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkETag sets the ETag of the response and responds with 304 when the client already has it
+func checkETag(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("Etag", etag)
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseETags(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []string
+	}{
+		{"empty", "", []string{}},
+		{"strong", `"a"`, []string{`"a"`}},
+		{"weak", `W/"a"`, []string{`W/"a"`}},
+		{"any", "*", []string{"*"}},
+		{"list", `"a", W/"b",W/"c"`, []string{`"a"`, `W/"b"`, `W/"c"`}},
+		{"comma in tag", `"a,b", "c"`, []string{`"a,b"`, `"c"`}},
+		{"malformed skipped", `a, "b"`, []string{`"b"`}},
+		{"unterminated", `"a", "b`, []string{`"a"`}},
+		{"extra whitespace", "  \"a\" ,\t\"b\"  ", []string{`"a"`, `"b"`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseETags(test.header)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseETags(%q) = %q, want %q", test.header, got, test.want)
+			}
+		})
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		etag   string
+		want   bool
+	}{
+		{"strong to strong", `"a"`, `"a"`, true},
+		{"weak to strong", `W/"a"`, `"a"`, true},
+		{"strong to weak", `"a"`, `W/"a"`, true},
+		{"weak to weak", `W/"a"`, `W/"a"`, true},
+		{"different", `"b"`, `"a"`, false},
+		{"in list", `"b", W/"a", "c"`, `W/"a"`, true},
+		{"not in list", `"b", W/"c"`, `W/"a"`, false},
+		{"any", "*", `"a"`, true},
+		{"prefix only", `"ab"`, `"a"`, false},
+		{"malformed", `a`, `"a"`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := etagMatches(test.header, test.etag)
+			if got != test.want {
+				t.Errorf("etagMatches(%q, %q) = %v, want %v", test.header, test.etag, got, test.want)
+			}
+		})
+	}
+}
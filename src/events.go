@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// keepAliveInterval is how often a comment is sent on idle streams, so proxies don't close them
+const keepAliveInterval = 30 * time.Second
+
+// runStateV2 is the live and next run of a schedule
+type runStateV2 struct {
+	Current *eventDataV2 `json:"current"`
+	Next    *eventDataV2 `json:"next"`
+}
+
+type runStateV3 struct {
+	Current *eventDataV3 `json:"current"`
+	Next    *eventDataV3 `json:"next"`
+}
+
+// runState finds the live and next run of the schedule at the time, in the format of the API version
+func runState(schedule scheduleData, at time.Time, version string) interface{} {
+	current, next := RunAt(schedule, at)
+
+	if version == "v3" {
+		ids := RunUIDs(schedule.Data)
+		state := runStateV3{}
+		if current > -1 {
+			run := schedule.Data[current].V3(ids[current], at)
+			state.Current = &run
+		}
+		if next > -1 {
+			run := schedule.Data[next].V3(ids[next], at)
+			state.Next = &run
+		}
+
+		return state
+	}
+
+	state := runStateV2{}
+	if current > -1 {
+		run := schedule.Data[current].V2()
+		state.Current = &run
+	}
+	if next > -1 {
+		run := schedule.Data[next].V2()
+		state.Next = &run
+	}
+
+	return state
+}
+
+// scheduleState is the whole schedule at the time, in the format of the API version
+func scheduleState(schedule scheduleData, at time.Time, version string) interface{} {
+	if version == "v3" {
+		return schedule.V3(schedule, at)
+	}
+
+	return schedule.V2()
+}
+
+// writeServerSentEvent writes an event in the text/event-stream format and sends it to the client
+func writeServerSentEvent(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	if err != nil {
+		return err
+	}
+
+	return http.NewResponseController(w).Flush()
+}
+
+// scheduleEventsHandler streams the schedule when it changes and the live run when a run starts or ends
+func scheduleEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Ignore Options request from CORS
+	if r.Method == http.MethodOptions {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	endpoint, ok := requestedEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	horaro, _, err := getHoraro(endpoint)
+	if err != nil {
+		writeUpstreamError(w, endpoint, err)
+		return
+	}
+
+	// The stream is long-lived, so the write timeout of the server doesn't apply
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	events, unsubscribe := subscribeSchedule(endpoint)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disable response buffering of nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	version := mux.Vars(r)["version"]
+	schedule := TransformDelayedHoraro(endpoint, horaro)
+	now := time.Now()
+	if writeServerSentEvent(w, "schedule", scheduleState(schedule, now, version)) != nil {
+		return
+	}
+	if writeServerSentEvent(w, "run", runState(schedule, now, version)) != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			if err == nil {
+				err = http.NewResponseController(w).Flush()
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			schedule := TransformDelayedHoraro(endpoint, event.Horaro)
+			if event.Type == "run" {
+				// The status of the runs changes too, so v3 streams get the whole schedule as well
+				if version == "v3" {
+					err = writeServerSentEvent(w, "schedule", scheduleState(schedule, time.Now(), version))
+				}
+				if err == nil {
+					err = writeServerSentEvent(w, "run", runState(schedule, time.Now(), version))
+				}
+			} else {
+				err = writeServerSentEvent(w, "schedule", scheduleState(schedule, time.Now(), version))
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	TTL           int       `xml:"ttl"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description"`
+	Category    string  `xml:"category,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string        `xml:"id"`
+	Title     string        `xml:"title"`
+	Published string        `xml:"published"`
+	Updated   string        `xml:"updated"`
+	Category  *atomCategory `xml:"category"`
+	Content   atomContent   `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// feedGUIDs is an identifier per run of the schedule, by its index, that is unique and stable for the run
+func feedGUIDs(schedule scheduleData) []string {
+	guids := RunUIDs(schedule.Data)
+	for i, uid := range guids {
+		guids[i] = schedule.Meta.URL + "#" + uid
+	}
+
+	return guids
+}
+
+// feedDescription describes a run in plain text for feed readers
+func feedDescription(run runData) string {
+	lines := []string{"Scheduled: " + run.Scheduled.UTC().Format(time.RFC1123)}
+	if run.Estimated != nil && !run.Estimated.Equal(run.Scheduled) {
+		lines = append(lines, "Estimated: "+run.Estimated.UTC().Format(time.RFC1123))
+	}
+	if category := stringValue(run.Category); category != "" {
+		lines = append(lines, "Category: "+category)
+	}
+	if len(run.Players) > 0 {
+		lines = append(lines, "Players: "+strings.Join(run.Players, ", "))
+	}
+	if platform := stringValue(run.Platform); platform != "" {
+		lines = append(lines, "Platform: "+platform)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// RenderRSS renders the upcoming runs as an RSS 2.0 feed
+func RenderRSS(schedule scheduleData, upcoming scheduleData) ([]byte, error) {
+	guids := feedGUIDs(schedule)
+
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         schedule.Meta.Name + " - Upcoming runs",
+			Link:          schedule.Meta.URL,
+			Description:   schedule.Meta.Description,
+			LastBuildDate: schedule.Meta.Updated.UTC().Format(time.RFC1123Z),
+			TTL:           10,
+			Items:         []rssItem{},
+		},
+	}
+	if feed.Channel.Description == "" {
+		feed.Channel.Description = "The upcoming runs of " + schedule.Meta.Name
+	}
+
+	for _, run := range upcoming.Data {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       runSummary(run),
+			Link:        schedule.Meta.URL,
+			Description: feedDescription(run),
+			Category:    stringValue(run.Category),
+			GUID:        rssGUID{Value: guids[run.Index]},
+			PubDate:     run.Start().UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
+
+// RenderAtom renders the upcoming runs as an Atom feed
+func RenderAtom(schedule scheduleData, upcoming scheduleData) ([]byte, error) {
+	guids := feedGUIDs(schedule)
+	updated := schedule.Meta.Updated.UTC().Format(time.RFC3339)
+
+	feed := atomFeed{
+		ID:      schedule.Meta.URL,
+		Title:   schedule.Meta.Name + " - Upcoming runs",
+		Updated: updated,
+		Link:    atomLink{Href: schedule.Meta.URL, Rel: "alternate"},
+		Author:  atomAuthor{Name: schedule.Meta.Event.Name},
+		Entries: []atomEntry{},
+	}
+	if feed.Author.Name == "" {
+		feed.Author.Name = schedule.Meta.Name
+	}
+
+	for _, run := range upcoming.Data {
+		entry := atomEntry{
+			ID:        guids[run.Index],
+			Title:     runSummary(run),
+			Published: run.Start().UTC().Format(time.RFC3339),
+			Updated:   updated,
+			Content:   atomContent{Type: "text", Value: feedDescription(run)},
+		}
+		if category := stringValue(run.Category); category != "" {
+			entry.Category = &atomCategory{Term: category}
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
 	"strings"
@@ -58,51 +61,139 @@ var httpClient = &http.Client{
 	Timeout:   10 * time.Second,
 }
 
-// FetchHoraro fetches the full events from horaro
-func FetchHoraro(endpoint string) (*HoraroResponse, error) {
+// maxResponseSize is the largest body that is accepted from Horaro
+const maxResponseSize = 10 << 20
+
+// ErrResponseTooLarge is returned when Horaro sends a body larger than maxResponseSize
+var ErrResponseTooLarge = errors.New("Response from Horaro is too large")
+
+// ErrNotModified is returned when Horaro confirms the data matching the validators is still current
+var ErrNotModified = errors.New("Horaro data has not been modified")
+
+// Validators are the headers Horaro sent to identify a version of its response
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// UpstreamStatusError is returned when Horaro responds with a non-2xx status code
+type UpstreamStatusError struct {
+	StatusCode int
+}
+
+func (e *UpstreamStatusError) Error() string {
+	return fmt.Sprintf("Horaro responded with status %d", e.StatusCode)
+}
+
+// ContentTypeError is returned when Horaro responds with something other than JSON
+type ContentTypeError struct {
+	ContentType string
+}
+
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("Horaro responded with unexpected content type '%s'", e.ContentType)
+}
+
+// fetchUpstream requests the endpoint and returns the body once the response is known to be usable JSON.
+// When validators are given the request is conditional and ErrNotModified is returned if nothing changed.
+func fetchUpstream(endpoint string, validators Validators) ([]byte, Validators, error) {
 	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
 	if err != nil {
-		return nil, err
+		return nil, Validators{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
 	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, Validators{}, err
 	}
 
 	defer resp.Body.Close()
 
-	var response HoraroResponse
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, validators, ErrNotModified
+	}
 
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, Validators{}, &UpstreamStatusError{StatusCode: resp.StatusCode}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return nil, Validators{}, &ContentTypeError{ContentType: contentType}
+	}
+
+	if resp.ContentLength > maxResponseSize {
+		return nil, Validators{}, ErrResponseTooLarge
+	}
+
+	// Read one byte more than allowed to detect bodies without a (correct) Content-Length
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
 	if err != nil {
-		return nil, err
+		return nil, Validators{}, err
+	}
+	if len(body) > maxResponseSize {
+		return nil, Validators{}, ErrResponseTooLarge
+	}
+
+	received := Validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
 	}
 
-	return &response, nil
+	return body, received, nil
 }
 
-func FetchHoraroApi(endpoint string) (*string, error) {
-	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+// FetchHoraro fetches the full events from horaro
+func FetchHoraro(endpoint string, validators Validators) (*HoraroResponse, Validators, error) {
+	body, received, err := fetchUpstream(endpoint, validators)
 	if err != nil {
-		return nil, err
+		return nil, received, err
 	}
 
-	resp, err := httpClient.Do(req)
+	var response HoraroResponse
+
+	err = json.Unmarshal(body, &response)
 	if err != nil {
-		return nil, err
+		return nil, Validators{}, err
 	}
 
-	defer resp.Body.Close()
-
-	buf := new(strings.Builder)
-	_, err = io.Copy(buf, resp.Body)
+	return &response, received, nil
+}
 
+// FetchHoraroApi fetches the raw body of a Horaro API endpoint
+func FetchHoraroApi(endpoint string, validators Validators) (*string, Validators, error) {
+	body, received, err := fetchUpstream(endpoint, validators)
 	if err != nil {
-		return nil, err
+		return nil, received, err
+	}
+
+	response := string(body)
+
+	return &response, received, nil
+}
+
+// UpstreamErrorStatus maps an error from fetching Horaro to the status code for the client
+func UpstreamErrorStatus(err error) int {
+	var statusErr *UpstreamStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone {
+			return http.StatusNotFound
+		}
+		return http.StatusBadGateway
 	}
 
-	response := buf.String()
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
 
-	return &response, nil
+	return http.StatusBadGateway
 }
@@ -18,24 +18,31 @@ func FormatHoraroEndpoint(parameter string) (*string, error) {
 
 	// If parameter isn't a URL
 	if nonURLPattern.MatchString(parameter) {
-		horaroURL := fmt.Sprintf("https://horaro.org/esa/%s", parameter)
+		horaroURL := fmt.Sprintf("%s/%s/%s", config.HoraroBaseURL, config.Organization, parameter)
 		return &horaroURL, nil
 	}
 
 	return ParseHoraroUrl(parameter)
 }
 
+// configuredEndpoint formats a schedule that doesn't come from a request path, like the ones in the config or in
+// websocket messages. Request paths are lowercased by CaselessMatcher, so the schedule is lowercased too to share
+// the cache keys of requests.
+func configuredEndpoint(schedule string) (*string, error) {
+	return FormatHoraroEndpoint(strings.ToLower(schedule))
+}
+
 func ParseHoraroUrl(parameter string) (*string, error) {
 	endpoint, err := url.Parse(parameter)
 	if err != nil {
 		return nil, errors.New("Can not parse URL")
 	}
 
-	if endpoint.Hostname() != "horaro.org" {
+	if indexOf(endpoint.Hostname(), config.AllowedHosts, strings.EqualFold) == -1 {
 		return nil, errors.New("Can not fetch from different domain than Horaro")
 	}
 
-	if endpoint.Scheme != "https" {
+	if endpoint.Scheme != "https" && !(endpoint.Scheme == "http" && config.AllowHTTP) {
 		return nil, errors.New("Can only fetch from HTTPS")
 	}
 
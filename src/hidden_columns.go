@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hiddenColumnsHeader is the request header carrying the key that includes hidden columns in the responses
+const hiddenColumnsHeader = "X-Hidden-Columns-Key"
+
+var nonAlphanumericPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// scheduleKey is the "organization/schedule" key of a schedule in the per-schedule config
+func scheduleKey(organization, schedule string) string {
+	return strings.ToLower(organization + "/" + schedule)
+}
+
+// scheduleSlug is the key of the schedule of a Horaro endpoint in the per-schedule config. It's read from the last
+// two segments of the path, as the base URL may have a path of its own.
+func scheduleSlug(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+
+	segments := strings.Split(strings.Trim(strings.TrimSuffix(parsed.Path, ".json"), "/"), "/")
+	if len(segments) < 2 {
+		return ""
+	}
+
+	return scheduleKey(segments[len(segments)-2], segments[len(segments)-1])
+}
+
+// withHiddenKey adds the Horaro hidden key configured for the schedule to the endpoint, so Horaro includes the
+// hidden columns
+func withHiddenKey(endpoint string) string {
+	key, ok := config.HoraroHiddenKeys[scheduleSlug(endpoint)]
+	if !ok {
+		return endpoint
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+
+	query := parsed.Query()
+	query.Set("hiddenkey", key)
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
+
+// hiddenColumnsAllowed reports whether the request carries the key for hidden columns
+func hiddenColumnsAllowed(r *http.Request) bool {
+	key := r.Header.Get(hiddenColumnsHeader)
+	if config.HiddenColumnsKey == "" || key == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(key), []byte(config.HiddenColumnsKey)) == 1
+}
+
+// visibleColumns are the columns of the schedule with the hidden ones blanked out, so indices stay the same
+func visibleColumns(horaro *HoraroResponse) []string {
+	visible := make([]string, len(horaro.Schedule.Columns))
+	for i, column := range horaro.Schedule.Columns {
+		if indexOf(column, horaro.Schedule.HiddenColumns, strings.EqualFold) == -1 {
+			visible[i] = column
+		}
+	}
+
+	return visible
+}
+
+// normalizedColumnNames turns the column names into keys like "player_s" for "Player(s)".
+// Names that end up the same get a number, e.g. "note" and "note_2".
+func normalizedColumnNames(columns []string) []string {
+	names := make([]string, len(columns))
+	seen := map[string]int{}
+
+	for i, column := range columns {
+		name := strings.Trim(nonAlphanumericPattern.ReplaceAllString(strings.ToLower(column), "_"), "_")
+		if name == "" {
+			name = "column"
+		}
+
+		seen[name]++
+		if seen[name] > 1 {
+			name += "_" + strconv.Itoa(seen[name])
+		}
+		names[i] = name
+	}
+
+	return names
+}
+
+// runColumns maps the normalized column names to the values of a run, leaving out the blank columns
+func runColumns(columns []string, names []string, data []*string) map[string]*string {
+	values := map[string]*string{}
+	for i, column := range columns {
+		if column != "" && i < len(data) {
+			values[names[i]] = data[i]
+		}
+	}
+
+	return values
+}
+
+// addHiddenColumns adds the values of the hidden columns to the columns of every run
+func (list *scheduleData) addHiddenColumns(horaro *HoraroResponse) {
+	names := normalizedColumnNames(horaro.Schedule.Columns)
+
+	for i, item := range horaro.Schedule.Items {
+		for j, column := range horaro.Schedule.Columns {
+			if j < len(item.Data) && indexOf(column, horaro.Schedule.HiddenColumns, strings.EqualFold) > -1 {
+				list.Data[i].Columns[names[j]] = item.Data[j]
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// watchInterval is how often a watched schedule is fetched from the cache, which refreshes it when it's stale
+const watchInterval = 15 * time.Second
+
+// scheduleEvent is pushed to the subscribers of a schedule
+type scheduleEvent struct {
+	// Type is "schedule" when the schedule changed, "delays" when the operators changed the delays and "run" when
+	// the live run changed
+	Type     string
+	Previous *HoraroResponse
+	Horaro   *HoraroResponse
+}
+
+// scheduleHub watches a schedule for as long as it has subscribers
+type scheduleHub struct {
+	endpoint    string
+	subscribers map[chan scheduleEvent]struct{}
+	stop        chan struct{}
+}
+
+var hubsMutex sync.Mutex
+var hubs = map[string]*scheduleHub{}
+
+func init() {
+	onScheduleChange(func(endpoint string, previous, current *HoraroResponse) {
+		// Subscribers got the schedule when subscribing, the first fetch is no change to them
+		if previous == nil {
+			return
+		}
+
+		publishSchedule(endpoint, scheduleEvent{Type: "schedule", Previous: previous, Horaro: current})
+	})
+}
+
+// subscribeSchedule starts receiving the events of the schedule, the channel is closed when unsubscribed.
+// Subscribers that don't keep up with the events are unsubscribed.
+func subscribeSchedule(endpoint string) (<-chan scheduleEvent, func()) {
+	events := make(chan scheduleEvent, 16)
+
+	hubsMutex.Lock()
+	hub, ok := hubs[endpoint]
+	if !ok {
+		hub = &scheduleHub{
+			endpoint:    endpoint,
+			subscribers: make(map[chan scheduleEvent]struct{}),
+			stop:        make(chan struct{}),
+		}
+		hubs[endpoint] = hub
+		go hub.watch()
+	}
+	hub.subscribers[events] = struct{}{}
+	hubsMutex.Unlock()
+
+	unsubscribe := func() {
+		hubsMutex.Lock()
+		defer hubsMutex.Unlock()
+
+		if _, ok := hub.subscribers[events]; !ok {
+			return
+		}
+
+		delete(hub.subscribers, events)
+		close(events)
+
+		if len(hub.subscribers) == 0 {
+			delete(hubs, endpoint)
+			close(hub.stop)
+		}
+	}
+
+	return events, unsubscribe
+}
+
+// publishSchedule sends the event to the subscribers of the schedule, if it has any
+func publishSchedule(endpoint string, event scheduleEvent) {
+	hubsMutex.Lock()
+	defer hubsMutex.Unlock()
+
+	hub, ok := hubs[endpoint]
+	if !ok {
+		return
+	}
+
+	for events := range hub.subscribers {
+		select {
+		case events <- event:
+		default:
+			log.Printf("Dropping slow subscriber of '%s'", endpoint)
+			delete(hub.subscribers, events)
+			close(events)
+		}
+	}
+
+	if len(hub.subscribers) == 0 {
+		delete(hubs, endpoint)
+		close(hub.stop)
+	}
+}
+
+// publishDelays sends the schedule to its subscribers after the delays changed, if it has any
+func publishDelays(endpoint string) {
+	hubsMutex.Lock()
+	_, ok := hubs[endpoint]
+	hubsMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	horaro, _, err := getHoraro(endpoint)
+	if err != nil {
+		log.Printf("Could not publish the delays of '%s': %s", endpoint, err.Error())
+		return
+	}
+
+	publishSchedule(endpoint, scheduleEvent{Type: "delays", Previous: horaro, Horaro: horaro})
+}
+
+// watch keeps the schedule fresh and publishes an event whenever the live run changes
+func (hub *scheduleHub) watch() {
+	var horaro *HoraroResponse
+	lastCurrent, lastNext := -1, -1
+
+	for {
+		wait := watchInterval
+
+		latest, _, err := getHoraro(hub.endpoint)
+		if err != nil {
+			log.Printf("Could not watch '%s': %s", hub.endpoint, err.Error())
+		} else {
+			now := time.Now()
+			schedule := TransformDelayedHoraro(hub.endpoint, latest)
+			current, next := RunAt(schedule, now)
+
+			if horaro != nil && (current != lastCurrent || next != lastNext) {
+				publishSchedule(hub.endpoint, scheduleEvent{Type: "run", Previous: horaro, Horaro: latest})
+			}
+			horaro, lastCurrent, lastNext = latest, current, next
+
+			// Wake up right after the next run starts or ends, instead of up to an interval later
+			if boundary, ok := NextRunBoundary(schedule, now); ok && boundary.Sub(now) < wait {
+				wait = boundary.Sub(now) + 100*time.Millisecond
+			}
+		}
+
+		select {
+		case <-hub.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
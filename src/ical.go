@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icalTimeFormat is the UTC date-time format of RFC 5545
+const icalTimeFormat = "20060102T150405Z"
+
+// icalRefreshInterval is the interval at which subscribed calendar clients should refresh
+const icalRefreshInterval = "PT10M"
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icalWriter writes content lines, folding them at 75 octets as required by RFC 5545
+type icalWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *icalWriter) line(name, value string) {
+	line := name + ":" + value
+	limit := 75
+
+	for len(line) > limit {
+		// Never fold in the middle of a UTF-8 sequence
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		w.buf.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = 74
+	}
+
+	w.buf.WriteString(line + "\r\n")
+}
+
+func (w *icalWriter) text(name, value string) {
+	w.line(name, icalEscaper.Replace(value))
+}
+
+// RunUIDs creates an identifier per run that stays the same when other runs are added or moved.
+// The ID column is used when it's filled in, otherwise the game and category identify the run.
+func RunUIDs(runs []runData) []string {
+	uids := make([]string, len(runs))
+	seen := make(map[string]int)
+
+	for i, run := range runs {
+		key := ""
+		if run.ID != nil && *run.ID != "" {
+			key = "id-" + *run.ID
+		} else {
+			key = "run-" + hash(stringValue(run.Game)+"\x00"+stringValue(run.Category))
+		}
+
+		// The same game and category can be run more than once, e.g. in a relay
+		seen[key]++
+		if seen[key] > 1 {
+			key = fmt.Sprintf("%s-%d", key, seen[key])
+		}
+
+		uids[i] = key
+	}
+
+	return uids
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+// runSummary is the title of a run, e.g. "Game (Category)"
+func runSummary(run runData) string {
+	summary := stringValue(run.Game)
+	if category := stringValue(run.Category); category != "" {
+		summary += " (" + category + ")"
+	}
+
+	return summary
+}
+
+// RenderICal renders the runs of the schedule as an RFC 5545 calendar with an event per run
+func RenderICal(schedule scheduleData, runs scheduleData) []byte {
+	w := &icalWriter{}
+	domain := hash(schedule.Meta.URL) + ".horaro-proxy"
+
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//European Speedrunner Assembly//Horaro Proxy//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.text("X-WR-CALNAME", schedule.Meta.Name)
+	if schedule.Meta.Description != "" {
+		w.text("X-WR-CALDESC", schedule.Meta.Description)
+	}
+	w.text("X-WR-TIMEZONE", schedule.Meta.Timezone)
+	w.line("REFRESH-INTERVAL;VALUE=DURATION", icalRefreshInterval)
+	w.line("X-PUBLISHED-TTL", icalRefreshInterval)
+
+	uids := RunUIDs(schedule.Data)
+	stamp := schedule.Meta.Updated.UTC().Format(icalTimeFormat)
+
+	for _, run := range runs.Data {
+		start := run.Start().UTC()
+		end := start.Add(time.Second * time.Duration(run.Length))
+
+		description := []string{}
+		if category := stringValue(run.Category); category != "" {
+			description = append(description, "Category: "+category)
+		}
+		if len(run.Players) > 0 {
+			description = append(description, "Players: "+strings.Join(run.Players, ", "))
+		}
+		if platform := stringValue(run.Platform); platform != "" {
+			description = append(description, "Platform: "+platform)
+		}
+
+		w.line("BEGIN", "VEVENT")
+		w.text("UID", uids[run.Index]+"@"+domain)
+		w.line("DTSTAMP", stamp)
+		w.line("DTSTART", start.Format(icalTimeFormat))
+		w.line("DTEND", end.Format(icalTimeFormat))
+		w.text("SUMMARY", runSummary(run))
+		if len(description) > 0 {
+			w.text("DESCRIPTION", strings.Join(description, "\n"))
+		}
+		if schedule.Meta.Twitch != "" {
+			w.text("LOCATION", "https://twitch.tv/"+schedule.Meta.Twitch)
+		}
+		if schedule.Meta.URL != "" {
+			w.line("URL", schedule.Meta.URL)
+		}
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+
+	return w.buf.Bytes()
+}
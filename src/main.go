@@ -6,12 +6,11 @@ import (
 	"hash/fnv"
 	"log"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
+	// Embed the time zone database, the container image doesn't have one
+	_ "time/tzdata"
 
 	"github.com/gorilla/mux"
-	"github.com/patrickmn/go-cache"
 )
 
 func hash(s string) string {
@@ -20,50 +19,57 @@ func hash(s string) string {
 	return fmt.Sprintf("%d", h.Sum32())
 }
 
-var expiration = 10 * time.Minute
-var cleanupInterval = 60 * time.Minute
-var memoryCache = cache.New(expiration, cleanupInterval)
+// writeUpstreamError responds with the status code matching the error from fetching Horaro
+func writeUpstreamError(w http.ResponseWriter, endpoint string, err error) {
+	log.Printf("Could not fetch the horaro data from '%s': %s", endpoint, err.Error())
 
-func getHoraro(endpoint string) (*HoraroResponse, error) {
-	response, found := memoryCache.Get(endpoint)
-	if found {
-		horaro, ok := response.(*HoraroResponse)
-
-		if ok {
-			return horaro, nil
-		}
+	status := UpstreamErrorStatus(err)
+	message := "Could not fetch the Horaro data"
+	if status == http.StatusNotFound {
+		message = "Could not find the Horaro data"
+	} else if status == http.StatusGatewayTimeout {
+		message = "Horaro did not respond in time"
 	}
 
-	log.Printf("Fetching new data for '%s' from Horaro", endpoint)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": message,
+	})
+}
 
-	horaro, err := FetchHoraro(endpoint)
+// requestedEndpoint is the Horaro endpoint in the URL, it responds with 400 if the endpoint is invalid
+func requestedEndpoint(w http.ResponseWriter, r *http.Request) (string, bool) {
+	// Get endpoint parameter from URL
+	parameter := mux.Vars(r)["endpoint"]
+	endpoint, err := FormatHoraroEndpoint(parameter)
 	if err != nil {
-		return nil, err
+		log.Printf("Invalid horaro link '%s': %s", parameter, err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": fmt.Sprintf("Invalid Horaro link: '%s'", err.Error()),
+		})
+		return "", false
 	}
 
-	defer memoryCache.Set(endpoint, horaro, cache.DefaultExpiration)
-
-	return horaro, nil
+	return *endpoint, true
 }
 
-func getHoraroApi(endpoint string) (*string, error) {
-	response, found := memoryCache.Get(endpoint)
-	if found {
-		horaro, ok := response.(*string)
-
-		if ok {
-			return horaro, nil
-		}
+// requestedSchedule fetches the schedule of the endpoint in the URL, it responds with the error if that fails
+func requestedSchedule(w http.ResponseWriter, r *http.Request) (string, *HoraroResponse, bool) {
+	endpoint, ok := requestedEndpoint(w, r)
+	if !ok {
+		return "", nil, false
 	}
 
-	horaro, err := FetchHoraroApi(endpoint)
+	horaro, status, err := getHoraro(endpoint)
 	if err != nil {
-		return nil, err
+		writeUpstreamError(w, endpoint, err)
+		return "", nil, false
 	}
 
-	defer memoryCache.Set(endpoint, horaro, cache.DefaultExpiration)
+	setCacheStatus(w, status)
 
-	return horaro, nil
+	return endpoint, horaro, true
 }
 
 func upcomingPageHandler(w http.ResponseWriter, r *http.Request) {
@@ -73,56 +79,70 @@ func upcomingPageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept, "+hiddenColumnsHeader)
 
-	// Get endpoint parameter from URL
-	parameter := mux.Vars(r)["endpoint"]
-	endpoint, err := FormatHoraroEndpoint(parameter)
-	if err != nil {
-		log.Printf("Invalid horaro link '%s': %s", parameter, err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "Invalid Horaro link",
-		})
+	params := newQueryParams(r)
+	amount := params.Int("amount", 5, 1, 100)
+	format := params.String("format", mux.Vars(r)["format"])
+	location := params.Location("timezone")
+	if !params.Valid(w) {
 		return
 	}
 
-	horaro, err := getHoraro(*endpoint)
-	if err != nil {
-		log.Printf("Could not find the horaro data from '%s': %s", *endpoint, err.Error())
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "Could not find the Horaro data",
-		})
+	renderer := negotiate(upcomingRenderers, format, r.Header.Get("Accept"))
+	if renderer == nil {
+		writeNotAcceptable(w, upcomingRenderers)
 		return
 	}
 
-	amountStr := r.FormValue("amount")
-	amount, err := strconv.Atoi(amountStr)
-	if amountStr == "" || err == nil {
-		amount = 5
+	endpoint, horaro, ok := requestedSchedule(w, r)
+	if !ok {
+		return
 	}
 
-	w.Header().Set("Cache-Control", "max-age=600")
+	schedule := TransformDelayedHoraro(endpoint, horaro)
+	hidden := hiddenColumnsAllowed(r)
+	if hidden {
+		schedule.addHiddenColumns(horaro)
+	}
 
-	eTag := `"` + hash(horaro.Schedule.Updated.UTC().Format(time.RFC3339Nano)) + `"`
-	w.Header().Set("Etag", eTag)
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if strings.Contains(match, eTag) {
-			w.WriteHeader(http.StatusNotModified)
-			return
-		}
+	now := time.Now()
+	input := &renderInput{
+		Version:  mux.Vars(r)["version"],
+		Schedule: schedule,
+		Runs:     UpcomingRuns(schedule, amount),
+		At:       now,
+		Location: location,
 	}
 
-	version := mux.Vars(r)["version"]
-	if version == "v1" {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(UpcomingHoraroV1(TransformHoraroV1(horaro), amount))
-	} else if version == "v2" {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(UpcomingHoraroV2(TransformHoraroV2(horaro), amount))
-	} else {
-		w.WriteHeader(http.StatusNotFound)
+	// The upcoming runs change when a run ends, clients may not cache them beyond that
+	maxAge := UpcomingMaxAge(schedule, now)
+	if input.Version == "v3" {
+		maxAge = statusMaxAge(schedule, now, maxAge)
 	}
+	cacheControl := fmt.Sprintf("max-age=%d", maxAge)
+	if hidden {
+		cacheControl = "private, " + cacheControl
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+
+	// The output only changes with the schedule and when a run ends, but isn't byte-for-byte identical (e.g. exported)
+	version := horaro.Schedule.Updated.UTC().Format(time.RFC3339Nano) + " " + renderer.Format + delaysVersion(endpoint)
+	if location != nil {
+		version += " " + location.String()
+	}
+	if hidden {
+		version += " hidden"
+	}
+	version += fmt.Sprintf(" %d", amount)
+	if len(input.Runs.Data) > 0 {
+		version += fmt.Sprintf(" %d", input.Runs.Data[0].Index)
+	}
+	if input.Version == "v3" {
+		version += runStatusVersion(schedule, now)
+	}
+
+	serveRendered(w, r, renderer, input, weakETag(version))
 }
 
 func schedulePageHandler(w http.ResponseWriter, r *http.Request) {
@@ -132,50 +152,81 @@ func schedulePageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept, "+hiddenColumnsHeader)
 
-	// Get endpoint parameter from URL
-	parameter := mux.Vars(r)["endpoint"]
-	endpoint, err := FormatHoraroEndpoint(parameter)
-	if err != nil {
-		log.Printf("Invalid horaro link '%s': %s", parameter, err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": fmt.Sprintf("Invalid Horaro link: '%s'", err.Error()),
-		})
+	params := newQueryParams(r)
+	format := params.String("format", mux.Vars(r)["format"])
+	location := params.Location("timezone")
+	at := params.Time("at")
+	if !params.Valid(w) {
 		return
 	}
 
-	horaro, err := getHoraro(*endpoint)
-	if err != nil {
-		log.Printf("Could not find the horaro data from '%s': %s", *endpoint, err.Error())
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "Could not find the Horaro data",
-		})
+	renderer := negotiate(scheduleRenderers, format, r.Header.Get("Accept"))
+	if renderer == nil {
+		writeNotAcceptable(w, scheduleRenderers)
 		return
 	}
 
-	w.Header().Set("Cache-Control", "max-age=360")
+	endpoint, horaro, ok := requestedSchedule(w, r)
+	if !ok {
+		return
+	}
 
-	eTag := `"` + hash(horaro.Schedule.Updated.UTC().Format(time.RFC3339Nano)) + `"`
-	w.Header().Set("Etag", eTag)
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if strings.Contains(match, eTag) {
-			w.WriteHeader(http.StatusNotModified)
+	// Past versions are served as they were planned, the delays only apply to the current one
+	delays := getDelays(endpoint)
+	if at != nil {
+		horaro, ok = archivedSchedule(w, endpoint, *at)
+		if !ok {
 			return
 		}
+		delays = nil
 	}
 
-	version := mux.Vars(r)["version"]
-	if version == "v1" {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(OrganizeHoraro(TransformHoraroV1(horaro)))
-	} else if version == "v2" {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(TransformHoraroV2(horaro))
-	} else {
-		w.WriteHeader(http.StatusNotFound)
+	schedule := TransformHoraro(horaro)
+	schedule.applyEstimates(EstimatedStarts(schedule, delays))
+
+	hidden := hiddenColumnsAllowed(r)
+	if hidden {
+		schedule.addHiddenColumns(horaro)
 	}
+
+	now := time.Now()
+	input := &renderInput{
+		Version:  mux.Vars(r)["version"],
+		Schedule: schedule,
+		Runs:     schedule,
+		At:       now,
+		Location: location,
+	}
+
+	// The status of the runs in v3 changes whenever a run starts or ends
+	maxAge := 360
+	if input.Version == "v3" {
+		maxAge = statusMaxAge(schedule, now, maxAge)
+	}
+	cacheControl := fmt.Sprintf("max-age=%d", maxAge)
+	if hidden {
+		cacheControl = "private, " + cacheControl
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+
+	// The output only changes when the schedule is updated, but isn't byte-for-byte identical (e.g. exported)
+	version := horaro.Schedule.Updated.UTC().Format(time.RFC3339Nano) + " " + renderer.Format
+	if location != nil {
+		version += " " + location.String()
+	}
+	if delays != nil {
+		version += delaysVersion(endpoint)
+	}
+	if hidden {
+		version += " hidden"
+	}
+	if input.Version == "v3" {
+		version += runStatusVersion(schedule, now)
+	}
+
+	serveRendered(w, r, renderer, input, weakETag(version))
 }
 
 // Special use-case, does not transform the data, just proxies the api.
@@ -199,25 +250,19 @@ func apiProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	horaro, err := getHoraroApi(*endpoint)
+	horaro, status, err := getHoraroApi(*endpoint)
 	if err != nil {
-		log.Printf("Could not find the horaro data from '%s': %s", *endpoint, err.Error())
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": "Could not find the Horaro data",
-		})
+		writeUpstreamError(w, *endpoint, err)
+		return
 	}
 
+	setCacheStatus(w, status)
+
 	// cache for 5 minutes
 	w.Header().Set("Cache-Control", "public, max-age=300")
 
-	eTag := `"` + hash(*horaro) + `"`
-	w.Header().Set("Etag", eTag)
-	if match := r.Header.Get("If-None-Match"); match != "" {
-		if strings.Contains(match, eTag) {
-			w.WriteHeader(http.StatusNotModified)
-			return
-		}
+	if checkETag(w, r, strongETag([]byte(*horaro))) {
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -237,12 +282,57 @@ func customCorsMiddleware(h http.Handler) http.Handler {
 }
 
 func main() {
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %s", err.Error())
+	}
+	config = cfg
+
+	log.Printf("Using Horaro at '%s' for organization '%s'", config.HoraroBaseURL, config.Organization)
+
+	cacheStore, err = newCacheBackend(config)
+	if err != nil {
+		log.Fatalf("Could not create the cache: %s", err.Error())
+	}
+
+	archive, err = newSnapshotArchive(config)
+	if err != nil {
+		log.Fatalf("Could not create the archive: %s", err.Error())
+	}
+
+	if config.DelaysFile != "" {
+		err = loadDelays(config.DelaysFile)
+		if err != nil {
+			log.Fatalf("Could not load the delays: %s", err.Error())
+		}
+	}
+
 	router := mux.NewRouter()
 	router.SkipClean(true)
-	router.HandleFunc("/{version:v[12]}/esa/upcoming/{endpoint:.+}", upcomingPageHandler).Methods(http.MethodGet, http.MethodOptions)
-	router.HandleFunc("/{version:v[12]}/esa/upcoming/{endpoint:.+}", upcomingPageHandler).Queries("amount", "{amount}").Methods(http.MethodGet, http.MethodOptions)
-	router.HandleFunc("/{version:v[12]}/esa/schedule/{endpoint:.+}", schedulePageHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/{version:v[123]}/esa/upcoming/{endpoint:.+}.{format:rss|atom|ics|csv|tsv}", upcomingPageHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/{version:v[123]}/esa/upcoming/{endpoint:.+}", upcomingPageHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/{version:v[123]}/esa/upcoming/{endpoint:.+}", upcomingPageHandler).Queries("amount", "{amount}").Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/{version:v[123]}/esa/schedule/{endpoint:.+}.{format:ics|csv|tsv}", schedulePageHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/{version:v[123]}/esa/schedule/{endpoint:.+}", schedulePageHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/{version:v[23]}/esa/events/{endpoint:.+}", scheduleEventsHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/{version:v[23]}/esa/now/{endpoint:.+}", nowPlayingHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/{version:v[123]}/esa/versions/{endpoint:.+}", scheduleVersionsHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/{version:v[23]}/esa/diff/{endpoint:.+}", scheduleDiffHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/v2/esa/ws", websocketHandler).Methods(http.MethodGet)
+	router.HandleFunc("/v3/schema.json", schemaHandler).Methods(http.MethodGet, http.MethodOptions)
 	router.HandleFunc("/api_proxy/{endpoint:.+}", apiProxy).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/prewarm/status", prewarmStatusHandler).Methods(http.MethodGet, http.MethodOptions)
+	router.HandleFunc("/admin/cache", requireAdmin(adminCacheListHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/cache", requireAdmin(adminCachePurgeAllHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/admin/cache/{endpoint:.+}", requireAdmin(adminCachePurgeHandler)).Methods(http.MethodDelete)
+	router.HandleFunc("/admin/refresh/{endpoint:.+}", requireAdmin(adminRefreshHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/delay/{endpoint:.+}", requireAdmin(adminDelayHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/delay/{endpoint:.+}", requireAdmin(adminSetDelayHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/admin/delay/{endpoint:.+}", requireAdmin(adminClearDelayHandler)).Methods(http.MethodDelete)
+
+	startWebhooks(config.Webhooks)
+	// Changes are only noticed when a schedule is fetched, so the schedules of webhooks are pre-warmed too
+	startPrewarming(webhookSchedules(config.Prewarm, config.Webhooks), config.PrewarmInterval.Duration)
 
 	handler := CaselessMatcher(router)
 	handler = customCorsMiddleware(handler)
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// nowPlaying is the state of an event at a point in time, independent of the API version
+type nowPlaying struct {
+	At time.Time
+	// State is "not-started", "live", "in-setup" between runs or "ended"
+	State string
+	// Previous, Current and Next are the indices of the runs, -1 when there is none
+	Previous int
+	Current  int
+	Next     int
+	// Elapsed and Remaining are the seconds since the current run started and until it ends
+	Elapsed   *int
+	Remaining *int
+	// Progress is the percentage of the current run that has passed
+	Progress *float64
+	// StartsIn is the number of seconds until the next run starts
+	StartsIn *int
+}
+
+type nowPlayingV2 struct {
+	Meta      horaroMetaV2 `json:"meta"`
+	At        JSONTime     `json:"at"`
+	State     string       `json:"state"`
+	Previous  *eventDataV2 `json:"previous"`
+	Current   *eventDataV2 `json:"current"`
+	Next      *eventDataV2 `json:"next"`
+	Elapsed   *int         `json:"elapsed"`
+	Remaining *int         `json:"remaining"`
+	Progress  *float64     `json:"progress"`
+	StartsIn  *int         `json:"starts_in"`
+}
+
+type nowPlayingV3 struct {
+	Meta      horaroMetaV3 `json:"meta"`
+	At        JSONTime     `json:"at"`
+	State     string       `json:"state"`
+	Previous  *eventDataV3 `json:"previous"`
+	Current   *eventDataV3 `json:"current"`
+	Next      *eventDataV3 `json:"next"`
+	Elapsed   *int         `json:"elapsed"`
+	Remaining *int         `json:"remaining"`
+	Progress  *float64     `json:"progress"`
+	StartsIn  *int         `json:"starts_in"`
+}
+
+// NowPlaying finds the previous, current and next run of the schedule at the time
+func NowPlaying(schedule scheduleData, at time.Time) nowPlaying {
+	now := nowPlaying{At: at}
+	now.Current, now.Next = RunAt(schedule, at)
+
+	now.Previous = len(schedule.Data) - 1
+	if now.Current > -1 {
+		now.Previous = now.Current - 1
+	} else if now.Next > -1 {
+		now.Previous = now.Next - 1
+	}
+
+	switch {
+	case now.Current > -1:
+		now.State = "live"
+	case len(schedule.Data) == 0 || now.Next == 0:
+		now.State = "not-started"
+	case now.Next > -1:
+		now.State = "in-setup"
+	default:
+		now.State = "ended"
+	}
+
+	if now.Next > -1 {
+		startsIn := int(schedule.Data[now.Next].Start().Sub(at) / time.Second)
+		now.StartsIn = &startsIn
+	}
+	if now.Current > -1 {
+		run := schedule.Data[now.Current]
+		elapsed := int(at.Sub(run.Start()) / time.Second)
+		remaining := run.Length - elapsed
+		progress := 100.0
+		if run.Length > 0 {
+			progress = math.Round(float64(elapsed)/float64(run.Length)*1000) / 10
+		}
+
+		now.Elapsed = &elapsed
+		now.Remaining = &remaining
+		now.Progress = &progress
+	}
+
+	return now
+}
+
+// V2 serializes the state in the format of API v2
+func (now nowPlaying) V2(schedule scheduleData) nowPlayingV2 {
+	run := func(index int) *eventDataV2 {
+		if index == -1 {
+			return nil
+		}
+
+		run := schedule.Data[index].V2()
+		return &run
+	}
+
+	return nowPlayingV2{
+		Meta:      schedule.Meta.V2(),
+		At:        JSONTime{now.At},
+		State:     now.State,
+		Previous:  run(now.Previous),
+		Current:   run(now.Current),
+		Next:      run(now.Next),
+		Elapsed:   now.Elapsed,
+		Remaining: now.Remaining,
+		Progress:  now.Progress,
+		StartsIn:  now.StartsIn,
+	}
+}
+
+// V3 serializes the state in the format of API v3
+func (now nowPlaying) V3(schedule scheduleData) nowPlayingV3 {
+	ids := RunUIDs(schedule.Data)
+	run := func(index int) *eventDataV3 {
+		if index == -1 {
+			return nil
+		}
+
+		run := schedule.Data[index].V3(ids[index], now.At)
+		return &run
+	}
+
+	return nowPlayingV3{
+		Meta:      schedule.Meta.V3(),
+		At:        JSONTime{now.At},
+		State:     now.State,
+		Previous:  run(now.Previous),
+		Current:   run(now.Current),
+		Next:      run(now.Next),
+		Elapsed:   now.Elapsed,
+		Remaining: now.Remaining,
+		Progress:  now.Progress,
+		StartsIn:  now.StartsIn,
+	}
+}
+
+// nowPlayingHandler serves the live run of an event with its progress and the runs around it
+func nowPlayingHandler(w http.ResponseWriter, r *http.Request) {
+	// Ignore Options request from CORS
+	if r.Method == http.MethodOptions {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	endpoint, horaro, ok := requestedSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	schedule := TransformDelayedHoraro(endpoint, horaro)
+	hidden := hiddenColumnsAllowed(r)
+	if hidden {
+		schedule.addHiddenColumns(horaro)
+	}
+
+	// The times change every second, but the runs only change when a run starts or ends
+	maxAge := 30 * time.Second
+	if boundary, ok := NextRunBoundary(schedule, now); ok && boundary.Sub(now) < maxAge {
+		maxAge = boundary.Sub(now)
+	}
+	cacheControl := "max-age=" + strconv.Itoa(int(maxAge/time.Second))
+	if hidden {
+		cacheControl = "private, " + cacheControl
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Vary", hiddenColumnsHeader)
+
+	playing := NowPlaying(schedule, now)
+
+	w.WriteHeader(http.StatusOK)
+	if mux.Vars(r)["version"] == "v3" {
+		json.NewEncoder(w).Encode(playing.V3(schedule))
+	} else {
+		json.NewEncoder(w).Encode(playing.V2(schedule))
+	}
+}
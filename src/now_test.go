@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// nowTestSchedule has hour long runs from 12:00 to 13:00, and after a gap from 14:00 to 15:00 and 15:00 to 16:00
+func nowTestSchedule() scheduleData {
+	return diffTestSchedule([]string{"a", "b", "c"}, []int{0, 2, 3})
+}
+
+func nowTestTime(hour, minute, second int) time.Time {
+	return time.Date(2024, 6, 1, hour, minute, second, 0, time.UTC)
+}
+
+func TestRunAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule scheduleData
+		at       time.Time
+		current  int
+		next     int
+	}{
+		{"empty", scheduleData{}, nowTestTime(12, 0, 0), -1, -1},
+		{"before the start", nowTestSchedule(), nowTestTime(11, 0, 0), -1, 0},
+		{"at the start", nowTestSchedule(), nowTestTime(12, 0, 0), 0, 1},
+		{"before the end", nowTestSchedule(), nowTestTime(12, 59, 59), 0, 1},
+		{"at the end", nowTestSchedule(), nowTestTime(13, 0, 0), -1, 1},
+		{"in the gap", nowTestSchedule(), nowTestTime(13, 30, 0), -1, 1},
+		{"at the start after a gap", nowTestSchedule(), nowTestTime(14, 0, 0), 1, 2},
+		{"between adjoining runs", nowTestSchedule(), nowTestTime(15, 0, 0), 2, -1},
+		{"at the end of the schedule", nowTestSchedule(), nowTestTime(16, 0, 0), -1, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current, next := RunAt(test.schedule, test.at)
+			if current != test.current || next != test.next {
+				t.Errorf("RunAt(%s) = %d, %d, want %d, %d", test.at.Format(time.TimeOnly), current, next, test.current, test.next)
+			}
+		})
+	}
+}
+
+func TestNowPlaying(t *testing.T) {
+	// -1 stands for null in elapsed, remaining, progress and startsIn
+	type nowState struct {
+		state                   string
+		previous, current, next int
+		elapsed, remaining      int
+		progress                float64
+		startsIn                int
+	}
+
+	tests := []struct {
+		name     string
+		schedule scheduleData
+		at       time.Time
+		want     nowState
+	}{
+		{"empty", scheduleData{}, nowTestTime(12, 0, 0), nowState{"not-started", -1, -1, -1, -1, -1, -1, -1}},
+		{"before the start", nowTestSchedule(), nowTestTime(11, 0, 0), nowState{"not-started", -1, -1, 0, -1, -1, -1, 3600}},
+		{"at the start", nowTestSchedule(), nowTestTime(12, 0, 0), nowState{"live", -1, 0, 1, 0, 3600, 0, 7200}},
+		{"halfway", nowTestSchedule(), nowTestTime(12, 30, 0), nowState{"live", -1, 0, 1, 1800, 1800, 50, 5400}},
+		{"at the end", nowTestSchedule(), nowTestTime(13, 0, 0), nowState{"in-setup", 0, -1, 1, -1, -1, -1, 3600}},
+		{"between adjoining runs", nowTestSchedule(), nowTestTime(15, 0, 0), nowState{"live", 1, 2, -1, 0, 3600, 0, -1}},
+		{"at the end of the schedule", nowTestSchedule(), nowTestTime(16, 0, 0), nowState{"ended", 2, -1, -1, -1, -1, -1, -1}},
+	}
+
+	orNull := func(value *int) int {
+		if value == nil {
+			return -1
+		}
+		return *value
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := NowPlaying(test.schedule, test.at)
+
+			got := nowState{
+				state:     now.State,
+				previous:  now.Previous,
+				current:   now.Current,
+				next:      now.Next,
+				elapsed:   orNull(now.Elapsed),
+				remaining: orNull(now.Remaining),
+				progress:  -1,
+				startsIn:  orNull(now.StartsIn),
+			}
+			if now.Progress != nil {
+				got.progress = *now.Progress
+			}
+
+			if got != test.want {
+				t.Errorf("NowPlaying(%s) = %+v, want %+v", test.at.Format(time.TimeOnly), got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// prewarmStatus is the outcome of keeping a configured schedule fresh
+type prewarmStatus struct {
+	Schedule    string     `json:"schedule"`
+	Endpoint    string     `json:"endpoint"`
+	LastSuccess *time.Time `json:"last_success"`
+	LastFailure *time.Time `json:"last_failure"`
+	LastError   *string    `json:"last_error"`
+}
+
+var prewarmMutex sync.RWMutex
+var prewarmStatuses = map[string]*prewarmStatus{}
+
+// startPrewarming refreshes the schedules on every interval so requests never wait for Horaro
+func startPrewarming(schedules []string, interval time.Duration) {
+	if len(schedules) == 0 {
+		return
+	}
+
+	log.Printf("Pre-warming %d schedule(s) every %s", len(schedules), interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			for _, schedule := range schedules {
+				prewarmSchedule(schedule)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+func prewarmSchedule(schedule string) {
+	status := prewarmStatus{Schedule: schedule}
+
+	prewarmMutex.RLock()
+	if previous, ok := prewarmStatuses[schedule]; ok {
+		status = *previous
+	}
+	prewarmMutex.RUnlock()
+
+	now := time.Now()
+
+	endpoint, err := configuredEndpoint(schedule)
+	if err == nil {
+		status.Endpoint = *endpoint
+		_, err = refreshHoraro(*endpoint)
+	}
+
+	if err != nil {
+		log.Printf("Could not pre-warm schedule '%s': %s", schedule, err.Error())
+		message := err.Error()
+		status.LastFailure = &now
+		status.LastError = &message
+	} else {
+		status.LastSuccess = &now
+	}
+
+	prewarmMutex.Lock()
+	prewarmStatuses[schedule] = &status
+	prewarmMutex.Unlock()
+}
+
+func prewarmStatusHandler(w http.ResponseWriter, r *http.Request) {
+	// Ignore Options request from CORS
+	if r.Method == http.MethodOptions {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	prewarmMutex.RLock()
+	statuses := make([]prewarmStatus, 0, len(prewarmStatuses))
+	for _, status := range prewarmStatuses {
+		statuses = append(statuses, *status)
+	}
+	prewarmMutex.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Schedule < statuses[j].Schedule
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"interval": config.PrewarmInterval.String(),
+		"data":     statuses,
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// paramError describes why a query parameter is invalid
+type paramError struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// queryParams reads the query parameters of a request and collects the errors of all invalid ones
+type queryParams struct {
+	values url.Values
+	errors []paramError
+}
+
+func newQueryParams(r *http.Request) *queryParams {
+	return &queryParams{values: r.URL.Query()}
+}
+
+func (q *queryParams) fail(name string, format string, args ...interface{}) {
+	q.errors = append(q.errors, paramError{Name: name, Message: fmt.Sprintf(format, args...)})
+}
+
+// Int returns the parameter as an integer between min and max, or def when it's not given
+func (q *queryParams) Int(name string, def, min, max int) int {
+	value := q.values.Get(name)
+	if value == "" {
+		return def
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < min || number > max {
+		q.fail(name, "Must be a whole number between %d and %d", min, max)
+		return def
+	}
+
+	return number
+}
+
+// String returns the parameter, or def when it's not given
+func (q *queryParams) String(name string, def string) string {
+	value := q.values.Get(name)
+	if value == "" {
+		return def
+	}
+
+	return value
+}
+
+// Location returns the parameter as time zone like "Europe/Stockholm", or nil when it's not given
+func (q *queryParams) Location(name string) *time.Location {
+	value := q.values.Get(name)
+	if value == "" {
+		return nil
+	}
+
+	location, err := time.LoadLocation(value)
+	if err != nil {
+		q.fail(name, "Must be a time zone like 'Europe/Stockholm' or 'UTC'")
+		return nil
+	}
+
+	return location
+}
+
+// Time returns the parameter as an RFC 3339 time like "2024-06-01T12:00:00Z", or nil when it's not given
+func (q *queryParams) Time(name string) *time.Time {
+	value := q.values.Get(name)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		q.fail(name, "Must be a time like '2024-06-01T12:00:00Z'")
+		return nil
+	}
+
+	return &parsed
+}
+
+// Valid responds with 400 and the list of invalid parameters if there are any
+func (q *queryParams) Valid(w http.ResponseWriter) bool {
+	if len(q.errors) == 0 {
+		return true
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      "Invalid query parameters",
+		"parameters": q.errors,
+	})
+
+	return false
+}
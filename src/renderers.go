@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// renderInput is everything a renderer can draw from
+type renderInput struct {
+	Version string
+	// Schedule contains all runs, Runs only the ones to render (e.g. the upcoming ones)
+	Schedule scheduleData
+	Runs     scheduleData
+	// At is the time the status of the runs is determined for
+	At time.Time
+	// Location is the time zone requested by the client, nil if none was
+	Location *time.Location
+}
+
+// renderer renders schedule data in one representation
+type renderer struct {
+	// Format is the name of the representation in the format query parameter and URL extension
+	Format      string
+	MediaType   string
+	ContentType string
+	Render      func(input *renderInput) ([]byte, error)
+}
+
+func encodeJSON(value interface{}) ([]byte, error) {
+	body := new(bytes.Buffer)
+	err := json.NewEncoder(body).Encode(value)
+	return body.Bytes(), err
+}
+
+func renderCSV(input *renderInput) ([]byte, error) {
+	return RenderCSV(input.Runs, ',', inputLocation(input))
+}
+
+func renderTSV(input *renderInput) ([]byte, error) {
+	return RenderCSV(input.Runs, '\t', inputLocation(input))
+}
+
+func renderICal(input *renderInput) ([]byte, error) {
+	return RenderICal(input.Schedule, input.Runs), nil
+}
+
+func inputLocation(input *renderInput) *time.Location {
+	if input.Location != nil {
+		return input.Location
+	}
+
+	return scheduleLocation(input.Schedule)
+}
+
+var csvRenderer = renderer{
+	Format:      "csv",
+	MediaType:   "text/csv",
+	ContentType: "text/csv; charset=utf-8; header=present",
+	Render:      renderCSV,
+}
+
+var tsvRenderer = renderer{
+	Format:      "tsv",
+	MediaType:   "text/tab-separated-values",
+	ContentType: "text/tab-separated-values; charset=utf-8",
+	Render:      renderTSV,
+}
+
+var icalRenderer = renderer{
+	Format:      "ics",
+	MediaType:   "text/calendar",
+	ContentType: "text/calendar; charset=utf-8",
+	Render:      renderICal,
+}
+
+// scheduleRenderers are the representations of the schedule routes, the first one is the default
+var scheduleRenderers = []renderer{
+	{
+		Format:      "json",
+		MediaType:   "application/json",
+		ContentType: "application/json",
+		Render: func(input *renderInput) ([]byte, error) {
+			if input.Version == "v1" {
+				return encodeJSON(OrganizeHoraro(input.Schedule.V1()))
+			}
+			if input.Version == "v3" {
+				return encodeJSON(input.Schedule.V3(input.Schedule, input.At))
+			}
+			return encodeJSON(input.Schedule.V2())
+		},
+	},
+	icalRenderer,
+	csvRenderer,
+	tsvRenderer,
+}
+
+// upcomingRenderers are the representations of the upcoming routes, the first one is the default
+var upcomingRenderers = []renderer{
+	{
+		Format:      "json",
+		MediaType:   "application/json",
+		ContentType: "application/json",
+		Render: func(input *renderInput) ([]byte, error) {
+			if input.Version == "v1" {
+				return encodeJSON(input.Runs.V1())
+			}
+			if input.Version == "v3" {
+				return encodeJSON(input.Runs.V3(input.Schedule, input.At))
+			}
+			return encodeJSON(input.Runs.V2())
+		},
+	},
+	{
+		Format:      "rss",
+		MediaType:   "application/rss+xml",
+		ContentType: "application/rss+xml; charset=utf-8",
+		Render: func(input *renderInput) ([]byte, error) {
+			return RenderRSS(input.Schedule, input.Runs)
+		},
+	},
+	{
+		Format:      "atom",
+		MediaType:   "application/atom+xml",
+		ContentType: "application/atom+xml; charset=utf-8",
+		Render: func(input *renderInput) ([]byte, error) {
+			return RenderAtom(input.Schedule, input.Runs)
+		},
+	},
+	icalRenderer,
+	csvRenderer,
+	tsvRenderer,
+}
+
+// mediaRange is a media range from the Accept header with its quality
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// specificity ranks "type/subtype" over "type/*" over "*/*"
+func (m mediaRange) specificity() int {
+	if m.mediaType == "*/*" {
+		return 0
+	}
+	if strings.HasSuffix(m.mediaType, "/*") {
+		return 1
+	}
+	return 2
+}
+
+// parseAccept parses the Accept header, ordered from most to least preferred and then most specific
+func parseAccept(header string) []mediaRange {
+	ranges := []mediaRange{}
+
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].quality != ranges[j].quality {
+			return ranges[i].quality > ranges[j].quality
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+
+	return ranges
+}
+
+// matches reports whether the media range (e.g. "text/*") includes the media type
+func (m mediaRange) matches(mediaType string) bool {
+	if m.mediaType == "*/*" || m.mediaType == mediaType {
+		return true
+	}
+
+	prefix, ok := strings.CutSuffix(m.mediaType, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// acceptQuality returns the quality the most specific matching media range gives the media type, 0 if none does
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range ranges {
+		if mediaRange.matches(mediaType) && mediaRange.specificity() > specificity {
+			quality, specificity = mediaRange.quality, mediaRange.specificity()
+		}
+	}
+
+	return quality
+}
+
+// negotiate picks the renderer by format, or by the Accept header when no format is given.
+// It returns nil when none of the renderers is acceptable.
+func negotiate(renderers []renderer, format string, accept string) *renderer {
+	if format != "" {
+		for i := range renderers {
+			if strings.EqualFold(renderers[i].Format, format) {
+				return &renderers[i]
+			}
+		}
+		return nil
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return &renderers[0]
+	}
+
+	// A media type refused with q=0 stays refused even if a wildcard accepts it.
+	// The renderers are in order of preference of the server, which breaks ties.
+	ranges := parseAccept(accept)
+	var best *renderer
+	bestQuality := 0.0
+	for i := range renderers {
+		quality := acceptQuality(ranges, renderers[i].MediaType)
+		if quality > bestQuality {
+			best, bestQuality = &renderers[i], quality
+		}
+	}
+
+	return best
+}
+
+// writeNotAcceptable responds with 406 and the media types that are available
+func writeNotAcceptable(w http.ResponseWriter, renderers []renderer) {
+	available := make([]string, len(renderers))
+	for i, renderer := range renderers {
+		available[i] = renderer.MediaType
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotAcceptable)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":     "None of the accepted media types is available",
+		"available": available,
+	})
+}
+
+// serveRendered renders the input with the renderer and responds with it, unless the client has it already.
+// Without an etag, the strong ETag of the rendered body is used.
+func serveRendered(w http.ResponseWriter, r *http.Request, renderer *renderer, input *renderInput, etag string) {
+	// A known ETag saves rendering when the client has the response already
+	if etag != "" && checkETag(w, r, etag) {
+		return
+	}
+
+	body, err := renderer.Render(input)
+	if err != nil {
+		writeRenderError(w, input, err)
+		return
+	}
+
+	if etag == "" && checkETag(w, r, strongETag(body)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", renderer.ContentType)
+	if renderer.MediaType != "application/json" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.%s"`, input.Schedule.Meta.Slug, renderer.Format))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func writeRenderError(w http.ResponseWriter, input *renderInput, err error) {
+	log.Printf("Could not render '%s': %s", input.Schedule.Meta.URL, err.Error())
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": "Could not render the schedule",
+	})
+}
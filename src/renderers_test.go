@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []mediaRange
+	}{
+		{"empty", "", []mediaRange{}},
+		{"single", "text/csv", []mediaRange{{"text/csv", 1}}},
+		{"by quality", "text/*;q=0.5, application/json", []mediaRange{{"application/json", 1}, {"text/*", 0.5}}},
+		{"by specificity", "*/*, text/*, text/csv", []mediaRange{{"text/csv", 1}, {"text/*", 1}, {"*/*", 1}}},
+		{"refused", "application/json;q=0, */*;q=0.5", []mediaRange{{"*/*", 0.5}, {"application/json", 0}}},
+		{"invalid skipped", "text/csv;q=x, bad/, text/calendar", []mediaRange{{"text/calendar", 1}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseAccept(test.header)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseAccept(%q) = %v, want %v", test.header, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	renderers := []renderer{
+		{Format: "json", MediaType: "application/json"},
+		{Format: "ics", MediaType: "text/calendar"},
+		{Format: "csv", MediaType: "text/csv"},
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		accept string
+		want   string
+	}{
+		{"default", "", "", "json"},
+		{"format", "csv", "application/json", "csv"},
+		{"format ignoring casing", "ICS", "", "ics"},
+		{"unknown format", "xml", "", ""},
+		{"exact", "", "text/csv", "csv"},
+		{"any", "", "*/*", "json"},
+		{"subtype wildcard", "", "text/*", "ics"},
+		{"by quality", "", "application/json;q=0.5, text/csv", "csv"},
+		{"refused under wildcard", "", "application/json;q=0, */*;q=0.5", "ics"},
+		{"refused under subtype wildcard", "", "text/calendar;q=0, text/*", "csv"},
+		{"specific quality wins", "", "application/json;q=0.2, */*;q=0.8", "ics"},
+		{"all refused", "", "application/json;q=0, text/*;q=0", ""},
+		{"unavailable", "", "application/xml", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			if renderer := negotiate(renderers, test.format, test.accept); renderer != nil {
+				got = renderer.Format
+			}
+			if got != test.want {
+				t.Errorf("negotiate(%q, %q) = %q, want %q", test.format, test.accept, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// schemaV3 is the JSON Schema of the schedule and upcoming responses of API v3
+//
+//go:embed schema_v3.json
+var schemaV3 []byte
+
+func schemaHandler(w http.ResponseWriter, r *http.Request) {
+	// Ignore Options request from CORS
+	if r.Method == http.MethodOptions {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	w.Write(schemaV3)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matches ISO 8601 durations like "PT1H30M" and clock durations like "1:30:00" or "5:00"
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+var clockDurationPattern = regexp.MustCompile(`^(?:(\d+):)?(\d+):(\d+)$`)
+
+// parseHoraroDuration reads a duration as Horaro writes it into a number of seconds
+func parseHoraroDuration(value string) (int, bool) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+
+	if match := isoDurationPattern.FindStringSubmatch(value); match != nil && value != "P" && value != "PT" {
+		return durationSeconds(match[1], 86400) + durationSeconds(match[2], 3600) + durationSeconds(match[3], 60) + durationSeconds(match[4], 1), true
+	}
+	if match := clockDurationPattern.FindStringSubmatch(value); match != nil {
+		return durationSeconds(match[1], 3600) + durationSeconds(match[2], 60) + durationSeconds(match[3], 1), true
+	}
+
+	return 0, false
+}
+
+func durationSeconds(value string, unit int) int {
+	number, _ := strconv.Atoi(value)
+	return number * unit
+}
+
+// customSetup is the setup time set for a single run in its options, nil if the run uses the default one
+func customSetup(options interface{}) *int {
+	values, ok := options.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	switch setup := values["setup"].(type) {
+	case string:
+		if seconds, ok := parseHoraroDuration(setup); ok {
+			return &seconds
+		}
+	case float64:
+		seconds := int(setup)
+		return &seconds
+	}
+
+	return nil
+}
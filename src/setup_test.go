@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestParseHoraroDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		seconds int
+		ok      bool
+	}{
+		{"PT1H30M", 5400, true},
+		{"PT5M", 300, true},
+		{"PT45S", 45, true},
+		{"P1DT1S", 86401, true},
+		{"P1D", 86400, true},
+		{"pt10m", 600, true},
+		{" PT1H ", 3600, true},
+		{"1:30:00", 5400, true},
+		{"5:00", 300, true},
+		{"", 0, false},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"PT1.5H", 0, false},
+		{"1h", 0, false},
+		{"90", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			seconds, ok := parseHoraroDuration(test.value)
+			if seconds != test.seconds || ok != test.ok {
+				t.Errorf("parseHoraroDuration(%q) = %d, %v, want %d, %v", test.value, seconds, ok, test.seconds, test.ok)
+			}
+		})
+	}
+}
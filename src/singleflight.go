@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// flightCall is a fetch that is in progress or has just completed
+type flightCall struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// flightGroup makes sure only one call per key is in flight, concurrent callers share its result
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// Do executes fn for the key, or waits for the call that is already in flight for it.
+// shared reports whether the result came from a call started by another caller.
+func (g *flightGroup) Do(key string, fn func() (interface{}, error)) (value interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err, true
+	}
+
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	// Release the waiters even if fn panics, they and the caller get the panic as error
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Call for '%s' panicked: %v", key, recovered)
+			call.value, call.err = nil, fmt.Errorf("Call for '%s' panicked: %v", key, recovered)
+			value, err = call.value, call.err
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	call.value, call.err = fn()
+
+	return call.value, call.err, false
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestFlightGroupPanic(t *testing.T) {
+	var group flightGroup
+	value, err, _ := group.Do("key", func() (interface{}, error) {
+		panic("boom")
+	})
+	if value != nil || err == nil {
+		t.Fatalf("Do() = %v, %v, want nil and an error", value, err)
+	}
+
+	// The key must be released so the next call runs again
+	value, err, _ = group.Do("key", func() (interface{}, error) {
+		return 1, nil
+	})
+	if value != 1 || err != nil {
+		t.Fatalf("Do() after panic = %v, %v, want 1, nil", value, err)
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"regexp"
-	"strings"
 	"time"
 )
 
@@ -81,8 +80,10 @@ type ScheduleHoraroResponseV2 struct {
 }
 
 type eventDataV1 struct {
-	Length    int         `json:"length"`
-	Scheduled time.Time   `json:"scheduled"`
+	Length    int       `json:"length"`
+	Scheduled time.Time `json:"scheduled"`
+	// Estimated is the start time including the delay set by the operators, only set when there is one
+	Estimated *time.Time  `json:"estimated,omitempty"`
 	Game      *string     `json:"game"`
 	Players   []string    `json:"players"`
 	Platform  *string     `json:"platform"`
@@ -92,11 +93,15 @@ type eventDataV1 struct {
 	Info      *string     `json:"info"`
 	ID        *string     `json:"id"`
 	Options   interface{} `json:"options"`
+	// Columns are the values of all columns by their normalized name
+	Columns map[string]*string `json:"columns"`
 }
 
 type eventDataV2 struct {
-	Length    int         `json:"length"`
-	Scheduled JSONTime    `json:"scheduled"`
+	Length    int      `json:"length"`
+	Scheduled JSONTime `json:"scheduled"`
+	// Estimated is the start time including the delay set by the operators, only set when there is one
+	Estimated *JSONTime   `json:"estimated,omitempty"`
 	Game      *string     `json:"game"`
 	Players   []string    `json:"players"`
 	Platform  *string     `json:"platform"`
@@ -106,6 +111,70 @@ type eventDataV2 struct {
 	Info      *string     `json:"info"`
 	ID        *string     `json:"id"`
 	Options   interface{} `json:"options"`
+	// Columns are the values of all columns by their normalized name
+	Columns map[string]*string `json:"columns"`
+}
+
+// scheduleMeta describes a schedule, independent of the API version
+type scheduleMeta struct {
+	Name        string
+	Slug        string
+	Timezone    string
+	Start       time.Time
+	Website     string
+	Twitter     string
+	Twitch      string
+	Description string
+	Setup       string
+	// SetupLength is the default number of seconds of setup after every run
+	SetupLength int
+	Updated     time.Time
+	URL         string
+	Event       struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	}
+	Exported time.Time
+}
+
+// runData is a run as read from Horaro, the API versions serialize it in their own format
+type runData struct {
+	// Index is the position of the run in the whole schedule, also in a selection of it like the upcoming runs
+	Index     int
+	Length    int
+	Scheduled time.Time
+	// Estimated is the start time including the delay set by the operators, nil when there is none
+	Estimated *time.Time
+	Game      *string
+	// Players is nil when the schedule has no players column
+	Players  []string
+	Platform *string
+	Category *string
+	Note     *string
+	Layout   *string
+	Info     *string
+	ID       *string
+	Options  interface{}
+	// Setup is the number of seconds of setup after the run, CustomSetup is set when the run overrides the default
+	Setup       int
+	CustomSetup *int
+	// Columns are the values of all columns by their normalized name
+	Columns map[string]*string
+}
+
+// scheduleData is a schedule as read from Horaro, every API version is a serialization of it
+type scheduleData struct {
+	Meta scheduleMeta
+	Data []runData
+}
+
+// Start is the estimated start time of the run, or the scheduled one if there is no estimate
+func (run runData) Start() time.Time {
+	if run.Estimated != nil {
+		return *run.Estimated
+	}
+
+	return run.Scheduled
 }
 
 // indexOf gets the index of an element in a list ignoring casing
@@ -128,6 +197,193 @@ func indexOf(element string, data []string, compareFunc func(s, t string) bool)
 // " & "
 var playersPattern = regexp.MustCompile(`\s*(\svs.\s|\svs\s|\s*,\s|\sand\s|\s&\s)\s*`)
 
+// TransformHoraro reads the response from the official horaro into the format all API versions are made from
+func TransformHoraro(horaro *HoraroResponse) scheduleData {
+	schedule := scheduleData{}
+
+	// Format response Meta
+	schedule.Meta.Name = horaro.Schedule.Name
+	schedule.Meta.Slug = horaro.Schedule.Slug
+	schedule.Meta.Timezone = horaro.Schedule.Timezone
+	schedule.Meta.Start = horaro.Schedule.Start
+	schedule.Meta.Website = horaro.Schedule.Website
+	schedule.Meta.Twitter = horaro.Schedule.Twitter
+	schedule.Meta.Twitch = horaro.Schedule.Twitch
+	schedule.Meta.Description = horaro.Schedule.Description
+	schedule.Meta.Setup = horaro.Schedule.Setup
+	schedule.Meta.SetupLength = horaro.Schedule.SetupT
+	if seconds, ok := parseHoraroDuration(horaro.Schedule.Setup); ok && schedule.Meta.SetupLength == 0 {
+		schedule.Meta.SetupLength = seconds
+	}
+	schedule.Meta.Updated = horaro.Schedule.Updated
+	schedule.Meta.URL = horaro.Schedule.URL
+	schedule.Meta.Event = horaro.Schedule.Event
+	schedule.Meta.Exported = horaro.Meta.Exported
+
+	// Format response Data
+	// Hidden columns are only ever exposed in the columns of runs, when explicitly asked for
+	visible := visibleColumns(horaro)
+	names := normalizedColumnNames(horaro.Schedule.Columns)
+	columns := columnMappingFor(horaro)
+	gameColumnIndex := columns.Index("game", visible)
+	playersColumnIndex := columns.Index("players", visible)
+	platformColumnIndex := columns.Index("platform", visible)
+	categoryColumnIndex := columns.Index("category", visible)
+	noteColumnIndex := columns.Index("note", visible)
+	layoutColumnIndex := columns.Index("layout", visible)
+	infoColumIndex := columns.Index("info", visible)
+	idColumnIndex := columns.Index("id", visible)
+
+	schedule.Data = make([]runData, len(horaro.Schedule.Items))
+
+	for i, value := range horaro.Schedule.Items {
+		run := &schedule.Data[i]
+		run.Index = i
+		run.Length = value.LengthT
+		run.Scheduled = value.Scheduled
+		run.Options = value.Options
+		run.Setup = schedule.Meta.SetupLength
+		run.CustomSetup = customSetup(value.Options)
+		if run.CustomSetup != nil {
+			run.Setup = *run.CustomSetup
+		}
+		run.Columns = runColumns(visible, names, value.Data)
+
+		if playersColumnIndex > -1 {
+			if value.Data[playersColumnIndex] != nil {
+				run.Players = playersPattern.Split(*value.Data[playersColumnIndex], -1)
+			} else {
+				run.Players = []string{}
+			}
+		}
+		if gameColumnIndex > -1 {
+			run.Game = value.Data[gameColumnIndex]
+		}
+		if platformColumnIndex > -1 {
+			run.Platform = value.Data[platformColumnIndex]
+		}
+		if categoryColumnIndex > -1 {
+			run.Category = value.Data[categoryColumnIndex]
+		}
+		if noteColumnIndex > -1 {
+			run.Note = value.Data[noteColumnIndex]
+		}
+		if layoutColumnIndex > -1 {
+			run.Layout = value.Data[layoutColumnIndex]
+		}
+		if infoColumIndex > -1 {
+			run.Info = value.Data[infoColumIndex]
+		}
+		if idColumnIndex > -1 {
+			run.ID = value.Data[idColumnIndex]
+		}
+	}
+
+	return schedule
+}
+
+// V1 serializes the meta in the format of API v1
+func (meta scheduleMeta) V1() horaroMetaV1 {
+	return horaroMetaV1{
+		Name:        meta.Name,
+		Slug:        meta.Slug,
+		Timezone:    meta.Timezone,
+		Start:       meta.Start,
+		Website:     meta.Website,
+		Twitter:     meta.Twitter,
+		Twitch:      meta.Twitch,
+		Description: meta.Description,
+		Setup:       meta.Setup,
+		Updated:     meta.Updated,
+		URL:         meta.URL,
+		Event:       meta.Event,
+		Exported:    meta.Exported,
+	}
+}
+
+// V2 serializes the meta in the format of API v2
+func (meta scheduleMeta) V2() horaroMetaV2 {
+	return horaroMetaV2{
+		Name:        meta.Name,
+		Slug:        meta.Slug,
+		Timezone:    meta.Timezone,
+		Start:       JSONTime{meta.Start},
+		Website:     meta.Website,
+		Twitter:     meta.Twitter,
+		Twitch:      meta.Twitch,
+		Description: meta.Description,
+		Setup:       meta.Setup,
+		Updated:     JSONTime{meta.Updated},
+		URL:         meta.URL,
+		Event:       meta.Event,
+		Exported:    JSONTime{meta.Exported},
+	}
+}
+
+// V1 serializes the run in the format of API v1. It has the same fields as v2, only the times are encoded differently.
+func (run runData) V1() eventDataV1 {
+	return eventDataV1{
+		Length:    run.Length,
+		Scheduled: run.Scheduled,
+		Estimated: run.Estimated,
+		Game:      run.Game,
+		Players:   run.Players,
+		Platform:  run.Platform,
+		Category:  run.Category,
+		Note:      run.Note,
+		Layout:    run.Layout,
+		Info:      run.Info,
+		ID:        run.ID,
+		Options:   run.Options,
+		Columns:   run.Columns,
+	}
+}
+
+// V2 serializes the run in the format of API v2
+func (run runData) V2() eventDataV2 {
+	event := eventDataV2{
+		Length:    run.Length,
+		Scheduled: JSONTime{run.Scheduled},
+		Game:      run.Game,
+		Players:   run.Players,
+		Platform:  run.Platform,
+		Category:  run.Category,
+		Note:      run.Note,
+		Layout:    run.Layout,
+		Info:      run.Info,
+		ID:        run.ID,
+		Options:   run.Options,
+		Columns:   run.Columns,
+	}
+	if run.Estimated != nil {
+		event.Estimated = &JSONTime{*run.Estimated}
+	}
+
+	return event
+}
+
+// V1 serializes the schedule in the list format of API v1
+func (schedule scheduleData) V1() TransformedHoraroResponseV1 {
+	response := TransformedHoraroResponseV1{Meta: schedule.Meta.V1()}
+	response.Data = make([]eventDataV1, len(schedule.Data))
+	for i, run := range schedule.Data {
+		response.Data[i] = run.V1()
+	}
+
+	return response
+}
+
+// V2 serializes the schedule in the list format of API v2
+func (schedule scheduleData) V2() TransformedHoraroResponseV2 {
+	response := TransformedHoraroResponseV2{Meta: schedule.Meta.V2()}
+	response.Data = make([]eventDataV2, len(schedule.Data))
+	for i, run := range schedule.Data {
+		response.Data[i] = run.V2()
+	}
+
+	return response
+}
+
 // OrganizeHoraro organizes the response from horaro into days
 func OrganizeHoraro(list TransformedHoraroResponseV1) ScheduleHoraroResponseV1 {
 	schedule := ScheduleHoraroResponseV1{}
@@ -149,12 +405,12 @@ func OrganizeHoraro(list TransformedHoraroResponseV1) ScheduleHoraroResponseV1 {
 	return schedule
 }
 
-// UpcomingHoraroV1 gets the upcoming values from horaro
-func UpcomingHoraroV1(list TransformedHoraroResponseV1, amount int) TransformedHoraroResponseV1 {
-	upcoming := TransformedHoraroResponseV1{}
+// UpcomingRuns gets the live and upcoming runs of the schedule
+func UpcomingRuns(list scheduleData, amount int) scheduleData {
+	upcoming := scheduleData{}
 	upcoming.Meta = list.Meta
 
-	upcoming.Data = []eventDataV1{}
+	upcoming.Data = []runData{}
 
 	now := time.Now()
 
@@ -163,8 +419,8 @@ func UpcomingHoraroV1(list TransformedHoraroResponseV1, amount int) TransformedH
 			break
 		}
 
-		start := value.Scheduled
-		end := value.Scheduled.Add(time.Second * time.Duration(value.Length))
+		start := value.Start()
+		end := start.Add(time.Second * time.Duration(value.Length))
 		if start.After(now) || (start.Before(now) && end.After(now)) {
 			upcoming.Data = append(upcoming.Data, value)
 		}
@@ -173,170 +429,52 @@ func UpcomingHoraroV1(list TransformedHoraroResponseV1, amount int) TransformedH
 	return upcoming
 }
 
-// UpcomingHoraroV2 gets the upcoming values from horaro
-func UpcomingHoraroV2(list TransformedHoraroResponseV2, amount int) TransformedHoraroResponseV2 {
-	upcoming := TransformedHoraroResponseV2{}
-	upcoming.Meta = list.Meta
+// RunAt finds the index of the run that is live at the time and of the first run after it, -1 if there is none
+func RunAt(list scheduleData, at time.Time) (current int, next int) {
+	current, next = -1, -1
 
-	upcoming.Data = []eventDataV2{}
+	for i, value := range list.Data {
+		start := value.Start()
+		end := start.Add(time.Second * time.Duration(value.Length))
 
-	now := time.Now()
-
-	for _, value := range list.Data {
-		if len(upcoming.Data) >= amount {
+		if !start.After(at) && end.After(at) {
+			current = i
+		} else if start.After(at) {
+			next = i
 			break
 		}
-
-		start := value.Scheduled
-		end := value.Scheduled.Add(time.Second * time.Duration(value.Length))
-		if start.After(now) || (start.Before(now) && end.After(now)) {
-			upcoming.Data = append(upcoming.Data, value)
-		}
 	}
 
-	return upcoming
+	return current, next
 }
 
-// TransformHoraroV1 transforms the response from the official horaro to a better format
-func TransformHoraroV1(horaro *HoraroResponse) TransformedHoraroResponseV1 {
-	response := TransformedHoraroResponseV1{}
-
-	// Format response Meta
-	response.Meta.Name = horaro.Schedule.Name
-	response.Meta.Slug = horaro.Schedule.Slug
-	response.Meta.Timezone = horaro.Schedule.Timezone
-	response.Meta.Start = horaro.Schedule.Start
-	response.Meta.Website = horaro.Schedule.Website
-	response.Meta.Twitter = horaro.Schedule.Twitter
-	response.Meta.Twitch = horaro.Schedule.Twitch
-	response.Meta.Description = horaro.Schedule.Description
-	response.Meta.Setup = horaro.Schedule.Setup
-	response.Meta.Updated = horaro.Schedule.Updated
-	response.Meta.URL = horaro.Schedule.URL
-	response.Meta.Event = horaro.Schedule.Event
-	response.Meta.Exported = horaro.Meta.Exported
-
-	// Format response Data
-	gameColumnIndex := indexOf("Game", horaro.Schedule.Columns, strings.EqualFold)
-	playersColumnIndex := indexOf("Player(s)", horaro.Schedule.Columns, strings.EqualFold)
-	platformColumnIndex := indexOf("Platform", horaro.Schedule.Columns, strings.EqualFold)
-	categoryColumnIndex := indexOf("Category", horaro.Schedule.Columns, strings.EqualFold)
-	noteColumnIndex := indexOf("Note", horaro.Schedule.Columns, strings.EqualFold)
-	layoutColumnIndex := indexOf("Layout", horaro.Schedule.Columns, strings.EqualFold)
-	infoColumIndex := indexOf("Info", horaro.Schedule.Columns, strings.EqualFold)
-	idColumnIndex := indexOf("ID", horaro.Schedule.Columns, strings.EqualFold)
-
-	eventList := make([]eventDataV1, len(horaro.Schedule.Items))
-
-	for i, value := range horaro.Schedule.Items {
-		eventList[i] = eventDataV1{}
-		eventList[i].Length = value.LengthT
-		eventList[i].Scheduled = value.Scheduled
-		eventList[i].Options = value.Options
+// NextRunBoundary is the first time after the given one at which a run starts or ends
+func NextRunBoundary(list scheduleData, after time.Time) (time.Time, bool) {
+	for _, value := range list.Data {
+		start := value.Start()
+		end := start.Add(time.Second * time.Duration(value.Length))
 
-		if playersColumnIndex > -1 {
-			if (value.Data[playersColumnIndex] != nil) {
-				eventList[i].Players = playersPattern.Split(*value.Data[playersColumnIndex], -1)
-			} else {
-				eventList[i].Players = []string{}
-			}
-		}
-		if gameColumnIndex > -1 {
-			eventList[i].Game = value.Data[gameColumnIndex]
-		}
-		if platformColumnIndex > -1 {
-			eventList[i].Platform = value.Data[platformColumnIndex]
-		}
-		if categoryColumnIndex > -1 {
-			eventList[i].Category = value.Data[categoryColumnIndex]
-		}
-		if noteColumnIndex > -1 {
-			eventList[i].Note = value.Data[noteColumnIndex]
-		}
-		if layoutColumnIndex > -1 {
-			eventList[i].Layout = value.Data[layoutColumnIndex]
+		if start.After(after) {
+			return start, true
 		}
-		if infoColumIndex > -1 {
-			eventList[i].Info = value.Data[infoColumIndex]
-		}
-		if idColumnIndex > -1 {
-			eventList[i].ID = value.Data[idColumnIndex]
+		if end.After(after) {
+			return end, true
 		}
 	}
 
-	response.Data = eventList
-
-	return response
+	return time.Time{}, false
 }
 
-// TransformHoraroV2 transforms the response from the official horaro to a better format
-func TransformHoraroV2(horaro *HoraroResponse) TransformedHoraroResponseV2 {
-	response := TransformedHoraroResponseV2{}
-
-	// Format response Meta
-	response.Meta.Name = horaro.Schedule.Name
-	response.Meta.Slug = horaro.Schedule.Slug
-	response.Meta.Timezone = horaro.Schedule.Timezone
-	response.Meta.Start = JSONTime{horaro.Schedule.Start}
-	response.Meta.Website = horaro.Schedule.Website
-	response.Meta.Twitter = horaro.Schedule.Twitter
-	response.Meta.Twitch = horaro.Schedule.Twitch
-	response.Meta.Description = horaro.Schedule.Description
-	response.Meta.Setup = horaro.Schedule.Setup
-	response.Meta.Updated = JSONTime{horaro.Schedule.Updated}
-	response.Meta.URL = horaro.Schedule.URL
-	response.Meta.Event = horaro.Schedule.Event
-	response.Meta.Exported = JSONTime{horaro.Meta.Exported}
+// UpcomingMaxAge is the number of seconds until the next run ends and the upcoming runs change, at most 10 minutes
+func UpcomingMaxAge(list scheduleData, now time.Time) int {
+	maxAge := 10 * time.Minute
 
-	// Format response Data
-	gameColumnIndex := indexOf("Game", horaro.Schedule.Columns, strings.EqualFold)
-	playersColumnIndex := indexOf("Player(s)", horaro.Schedule.Columns, strings.EqualFold)
-	platformColumnIndex := indexOf("Platform", horaro.Schedule.Columns, strings.EqualFold)
-	categoryColumnIndex := indexOf("Category", horaro.Schedule.Columns, strings.EqualFold)
-	noteColumnIndex := indexOf("Note", horaro.Schedule.Columns, strings.EqualFold)
-	layoutColumnIndex := indexOf("Layout", horaro.Schedule.Columns, strings.EqualFold)
-	infoColumIndex := indexOf("Info", horaro.Schedule.Columns, strings.EqualFold)
-	idColumnIndex := indexOf("ID", horaro.Schedule.Columns, strings.EqualFold)
-
-	eventList := make([]eventDataV2, len(horaro.Schedule.Items))
-
-	for i, value := range horaro.Schedule.Items {
-		eventList[i] = eventDataV2{}
-		eventList[i].Length = value.LengthT
-		eventList[i].Scheduled = JSONTime{value.Scheduled}
-		eventList[i].Options = value.Options
-
-		if playersColumnIndex > -1 {
-			if (value.Data[playersColumnIndex] != nil) {
-				eventList[i].Players = playersPattern.Split(*value.Data[playersColumnIndex], -1)
-			} else {
-				eventList[i].Players = []string{}
-			}
-		}
-		if gameColumnIndex > -1 {
-			eventList[i].Game = value.Data[gameColumnIndex]
-		}
-		if platformColumnIndex > -1 {
-			eventList[i].Platform = value.Data[platformColumnIndex]
-		}
-		if categoryColumnIndex > -1 {
-			eventList[i].Category = value.Data[categoryColumnIndex]
-		}
-		if noteColumnIndex > -1 {
-			eventList[i].Note = value.Data[noteColumnIndex]
-		}
-		if layoutColumnIndex > -1 {
-			eventList[i].Layout = value.Data[layoutColumnIndex]
-		}
-		if infoColumIndex > -1 {
-			eventList[i].Info = value.Data[infoColumIndex]
-		}
-		if idColumnIndex > -1 {
-			eventList[i].ID = value.Data[idColumnIndex]
+	for _, value := range list.Data {
+		end := value.Start().Add(time.Second * time.Duration(value.Length))
+		if end.After(now) && end.Sub(now) < maxAge {
+			maxAge = end.Sub(now)
 		}
 	}
 
-	response.Data = eventList
-
-	return response
+	return int(maxAge / time.Second)
 }
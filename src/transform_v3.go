@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The status of a run in API v3
+const (
+	runUpcoming = "upcoming"
+	runLive     = "live"
+	runFinished = "finished"
+)
+
+type horaroMetaV3 struct {
+	Name        string   `json:"name"`
+	Slug        string   `json:"slug"`
+	Timezone    string   `json:"timezone"`
+	Start       JSONTime `json:"start"`
+	Website     string   `json:"website"`
+	Twitter     string   `json:"twitter"`
+	Twitch      string   `json:"twitch"`
+	Description string   `json:"description"`
+	// Setup is the default number of seconds of setup after every run
+	Setup   int      `json:"setup"`
+	Updated JSONTime `json:"updated"`
+	URL     string   `json:"url"`
+	Event   struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	} `json:"event"`
+	Exported JSONTime `json:"exported"`
+}
+
+type playerV3 struct {
+	Name string `json:"name"`
+	// Links are the URLs of the Markdown links in the player column, e.g. to their stream
+	Links []string `json:"links"`
+}
+
+type runOptionsV3 struct {
+	// Setup is the number of seconds of setup set for the run in Horaro, null when it uses the default
+	Setup *int `json:"setup"`
+	// Other are the remaining options of the run in Horaro as they are, their format isn't documented by Horaro
+	Other map[string]interface{} `json:"other"`
+}
+
+type eventDataV3 struct {
+	// ID stays the same when other runs are added or moved, as in the schedule diffs
+	ID     string `json:"id"`
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	// Start and End include the delay set by the operators, Delay is the number of seconds it adds
+	Scheduled JSONTime   `json:"scheduled"`
+	Start     JSONTime   `json:"start"`
+	End       JSONTime   `json:"end"`
+	Delay     int        `json:"delay"`
+	Length    int        `json:"length"`
+	Setup     int        `json:"setup"`
+	Game      string     `json:"game"`
+	Players   []playerV3 `json:"players"`
+	Platform  string     `json:"platform"`
+	Category  string     `json:"category"`
+	Note      string     `json:"note"`
+	Layout    string     `json:"layout"`
+	Info      string     `json:"info"`
+	// ExternalID is the value of the ID column
+	ExternalID string            `json:"external_id"`
+	Options    runOptionsV3      `json:"options"`
+	Columns    map[string]string `json:"columns"`
+}
+
+// TransformedHoraroResponseV3 is the modified response from horaro in the format of API v3
+type TransformedHoraroResponseV3 struct {
+	Meta horaroMetaV3  `json:"meta"`
+	Data []eventDataV3 `json:"data"`
+}
+
+// Matches Markdown links like "[name](https://twitch.tv/name)"
+var markdownLinkPattern = regexp.MustCompile(`\[([^\]]*)\]\(([^)\s]+)\)`)
+
+// V3 serializes the meta in the format of API v3
+func (meta scheduleMeta) V3() horaroMetaV3 {
+	return horaroMetaV3{
+		Name:        meta.Name,
+		Slug:        meta.Slug,
+		Timezone:    meta.Timezone,
+		Start:       JSONTime{meta.Start},
+		Website:     meta.Website,
+		Twitter:     meta.Twitter,
+		Twitch:      meta.Twitch,
+		Description: meta.Description,
+		Setup:       meta.SetupLength,
+		Updated:     JSONTime{meta.Updated},
+		URL:         meta.URL,
+		Event:       meta.Event,
+		Exported:    JSONTime{meta.Exported},
+	}
+}
+
+// Status is whether the run is upcoming, live or finished at the time
+func (run runData) Status(at time.Time) string {
+	start := run.Start()
+	end := start.Add(time.Second * time.Duration(run.Length))
+
+	switch {
+	case start.After(at):
+		return runUpcoming
+	case end.After(at):
+		return runLive
+	default:
+		return runFinished
+	}
+}
+
+// parsePlayers reads the players into their names and the links in them, leaving out empty ones
+func parsePlayers(players []string) []playerV3 {
+	parsed := []playerV3{}
+	for _, value := range players {
+		player := playerV3{Links: []string{}}
+		for _, match := range markdownLinkPattern.FindAllStringSubmatch(value, -1) {
+			player.Links = append(player.Links, match[2])
+		}
+		player.Name = strings.TrimSpace(markdownLinkPattern.ReplaceAllString(value, "$1"))
+
+		if player.Name != "" || len(player.Links) > 0 {
+			parsed = append(parsed, player)
+		}
+	}
+
+	return parsed
+}
+
+// runOptions reads the options of the run, with the setup typed and the other options as they are
+func runOptions(run runData) runOptionsV3 {
+	options := runOptionsV3{Setup: run.CustomSetup, Other: map[string]interface{}{}}
+	if values, ok := run.Options.(map[string]interface{}); ok {
+		for name, value := range values {
+			if name != "setup" {
+				options.Other[name] = value
+			}
+		}
+	}
+
+	return options
+}
+
+// V3 serializes the run in the format of API v3, with its ID in the whole schedule
+func (run runData) V3(id string, at time.Time) eventDataV3 {
+	start := run.Start()
+	columns := map[string]string{}
+	for name, value := range run.Columns {
+		columns[name] = stringValue(value)
+	}
+
+	return eventDataV3{
+		ID:         id,
+		Index:      run.Index,
+		Status:     run.Status(at),
+		Scheduled:  JSONTime{run.Scheduled},
+		Start:      JSONTime{start},
+		End:        JSONTime{start.Add(time.Second * time.Duration(run.Length))},
+		Delay:      int(start.Sub(run.Scheduled) / time.Second),
+		Length:     run.Length,
+		Setup:      run.Setup,
+		Game:       stringValue(run.Game),
+		Players:    parsePlayers(run.Players),
+		Platform:   stringValue(run.Platform),
+		Category:   stringValue(run.Category),
+		Note:       stringValue(run.Note),
+		Layout:     stringValue(run.Layout),
+		Info:       stringValue(run.Info),
+		ExternalID: stringValue(run.ID),
+		Options:    runOptions(run),
+		Columns:    columns,
+	}
+}
+
+// V3 serializes the runs in the format of API v3, the IDs and indices of the runs are the ones in the whole schedule
+func (list scheduleData) V3(schedule scheduleData, at time.Time) TransformedHoraroResponseV3 {
+	ids := RunUIDs(schedule.Data)
+
+	response := TransformedHoraroResponseV3{Meta: list.Meta.V3()}
+	response.Data = make([]eventDataV3, len(list.Data))
+	for i, run := range list.Data {
+		response.Data[i] = run.V3(ids[run.Index], at)
+	}
+
+	return response
+}
+
+// runStatusVersion changes whenever the status of a run changes, for ETags
+func runStatusVersion(schedule scheduleData, at time.Time) string {
+	current, next := RunAt(schedule, at)
+	return fmt.Sprintf(" %d:%d", current, next)
+}
+
+// statusMaxAge caps the number of seconds a response may be cached at the next time a run starts or ends,
+// as the status of the runs changes then
+func statusMaxAge(schedule scheduleData, now time.Time, maxAge int) int {
+	if boundary, ok := NextRunBoundary(schedule, now); ok && boundary.Sub(now) < time.Duration(maxAge)*time.Second {
+		return int(boundary.Sub(now) / time.Second)
+	}
+
+	return maxAge
+}
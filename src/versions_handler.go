@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// archivedSchedule returns the version of the requested schedule that was current at the time, it responds with
+// 404 when no version of that time was archived
+func archivedSchedule(w http.ResponseWriter, endpoint string, at time.Time) (*HoraroResponse, bool) {
+	horaro := snapshotAt(endpoint, at)
+	if horaro == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "No version of the schedule is known at that time",
+		})
+		return nil, false
+	}
+
+	return horaro, true
+}
+
+// scheduleVersionsHandler lists the archived versions of a schedule
+func scheduleVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Ignore Options request from CORS
+	if r.Method == http.MethodOptions {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	endpoint, _, ok := requestedSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	parameter := mux.Vars(r)["endpoint"]
+
+	type scheduleVersion struct {
+		Updated JSONTime `json:"updated"`
+		URL     string   `json:"url"`
+	}
+
+	versions := []scheduleVersion{}
+	for _, updated := range archive.Versions(endpoint) {
+		at := url.QueryEscape(updated.UTC().Format(time.RFC3339Nano))
+		versions = append(versions, scheduleVersion{
+			Updated: JSONTime{updated},
+			URL:     fmt.Sprintf("/%s/esa/schedule/%s?at=%s", mux.Vars(r)["version"], parameter, at),
+		})
+	}
+
+	w.Header().Set("Cache-Control", "max-age=60")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": versions,
+	})
+}
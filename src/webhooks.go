@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webhookRetries are the waits before retrying a failed delivery
+var webhookRetries = []time.Duration{5 * time.Second, 30 * time.Second, 2 * time.Minute}
+
+// webhookPayload is the body posted to webhooks
+type webhookPayload struct {
+	Event    string `json:"event"`
+	Schedule string `json:"schedule"`
+	Endpoint string `json:"endpoint"`
+	// PreviousUpdated is the update time of the schedule the changes are relative to
+	PreviousUpdated JSONTime     `json:"previous_updated"`
+	Updated         JSONTime     `json:"updated"`
+	Meta            horaroMetaV2 `json:"meta"`
+	Changes         ScheduleDiff `json:"changes"`
+}
+
+// startWebhooks calls the configured webhooks whenever their schedule changes
+func startWebhooks(webhooks []WebhookConfig) {
+	if len(webhooks) == 0 {
+		return
+	}
+
+	byEndpoint := map[string][]WebhookConfig{}
+	for _, webhook := range webhooks {
+		endpoint, err := configuredEndpoint(webhook.Schedule)
+		if err != nil {
+			log.Printf("Not calling webhook '%s' for invalid schedule '%s': %s", webhook.URL, webhook.Schedule, err.Error())
+			continue
+		}
+
+		byEndpoint[*endpoint] = append(byEndpoint[*endpoint], webhook)
+	}
+
+	log.Printf("Calling %d webhook(s) on schedule changes", len(webhooks))
+
+	onScheduleChange(func(endpoint string, previous, current *HoraroResponse) {
+		// Without a previous schedule there is nothing to compare to
+		if previous == nil || len(byEndpoint[endpoint]) == 0 {
+			return
+		}
+
+		schedule := TransformHoraro(current)
+		changes := DiffSchedules(TransformHoraro(previous), schedule)
+
+		for _, webhook := range byEndpoint[endpoint] {
+			payload := webhookPayload{
+				Event:           "schedule.updated",
+				Schedule:        webhook.Schedule,
+				Endpoint:        endpoint,
+				PreviousUpdated: JSONTime{previous.Schedule.Updated},
+				Updated:         JSONTime{current.Schedule.Updated},
+				Meta:            schedule.Meta.V2(),
+				Changes:         changes,
+			}
+
+			go deliverWebhook(webhook, payload)
+		}
+	})
+}
+
+// webhookSchedules adds the schedules of the webhooks to the list, so they are polled for changes
+func webhookSchedules(schedules []string, webhooks []WebhookConfig) []string {
+	result := append([]string{}, schedules...)
+	for _, webhook := range webhooks {
+		if indexOf(webhook.Schedule, result, strings.EqualFold) == -1 {
+			result = append(result, webhook.Schedule)
+		}
+	}
+
+	return result
+}
+
+// signWebhook computes the hex HMAC-SHA256 of the timestamp and body, joined by a dot
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhook posts the payload, retrying on failures
+func deliverWebhook(webhook WebhookConfig, payload webhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Could not encode webhook for '%s': %s", webhook.URL, err.Error())
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = postWebhook(webhook, body)
+		if err == nil {
+			return
+		}
+
+		if attempt >= len(webhookRetries) {
+			log.Printf("Giving up on webhook '%s': %s", webhook.URL, err.Error())
+			return
+		}
+
+		log.Printf("Could not call webhook '%s', retrying in %s: %s", webhook.URL, webhookRetries[attempt], err.Error())
+		time.Sleep(webhookRetries[attempt])
+	}
+}
+
+func postWebhook(webhook WebhookConfig, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	// The timestamp is signed too, so receivers can reject replayed requests
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-Timestamp", timestamp)
+	request.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(webhook.Secret, timestamp, body))
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Webhook responded with status %d", response.StatusCode)
+	}
+
+	return nil
+}
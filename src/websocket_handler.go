@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// pingInterval is how often clients are pinged, clients that don't respond within two intervals are dropped
+const pingInterval = 30 * time.Second
+
+// maxSubscriptions is the number of schedules a single connection can subscribe to
+const maxSubscriptions = 10
+
+// maxWebsocketMessage is the largest message accepted from clients, they only send small commands
+const maxWebsocketMessage = 64 << 10
+
+var websocketUpgrader = websocket.Upgrader{
+	// The API can be used from any origin, like the CORS headers allow
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": reason.Error(),
+		})
+	},
+}
+
+// websocketCommand is a message from the client
+type websocketCommand struct {
+	// Type is "subscribe" or "unsubscribe"
+	Type     string `json:"type"`
+	Endpoint string `json:"endpoint"`
+}
+
+// websocketMessage is a message to the client
+type websocketMessage struct {
+	// Type is "schedule", "diff" or "error"
+	Type     string        `json:"type"`
+	Endpoint string        `json:"endpoint,omitempty"`
+	Meta     *horaroMetaV2 `json:"meta,omitempty"`
+	Data     interface{}   `json:"data,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// websocketSubscription is the subscription of a session to the events of a schedule
+type websocketSubscription struct {
+	unsubscribe func()
+}
+
+// websocketSession is a connected client with its subscriptions by the endpoint as the client sent it
+type websocketSession struct {
+	conn *websocket.Conn
+	// writeMutex guards writing data messages, the connection supports only one writer at a time
+	writeMutex sync.Mutex
+
+	mu            sync.Mutex
+	subscriptions map[string]*websocketSubscription
+}
+
+func (s *websocketSession) send(message websocketMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (s *websocketSession) sendError(endpoint string, message string) error {
+	return s.send(websocketMessage{Type: "error", Endpoint: endpoint, Error: message})
+}
+
+func (s *websocketSession) subscribe(parameter string) error {
+	s.mu.Lock()
+	_, subscribed := s.subscriptions[parameter]
+	full := len(s.subscriptions) >= maxSubscriptions
+	s.mu.Unlock()
+
+	if subscribed {
+		return nil
+	}
+	if full {
+		return s.sendError(parameter, "Too many subscriptions")
+	}
+
+	endpoint, err := configuredEndpoint(parameter)
+	if err != nil {
+		return s.sendError(parameter, fmt.Sprintf("Invalid Horaro link: '%s'", err.Error()))
+	}
+
+	horaro, _, err := getHoraro(*endpoint)
+	if err != nil {
+		log.Printf("Could not fetch the horaro data from '%s': %s", *endpoint, err.Error())
+		return s.sendError(parameter, "Could not fetch the Horaro data")
+	}
+
+	events, unsubscribe := subscribeSchedule(*endpoint)
+	subscription := &websocketSubscription{unsubscribe: unsubscribe}
+
+	s.mu.Lock()
+	s.subscriptions[parameter] = subscription
+	s.mu.Unlock()
+
+	schedule := TransformDelayedHoraro(*endpoint, horaro).V2()
+	err = s.send(websocketMessage{Type: "schedule", Endpoint: parameter, Meta: &schedule.Meta, Data: schedule})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for event := range events {
+			var message websocketMessage
+			switch event.Type {
+			case "schedule":
+				current := TransformDelayedHoraro(*endpoint, event.Horaro)
+				diff := DiffSchedules(TransformDelayedHoraro(*endpoint, event.Previous), current)
+				meta := current.Meta.V2()
+				message = websocketMessage{Type: "diff", Endpoint: parameter, Meta: &meta, Data: diff}
+			case "delays":
+				// Diffs don't cover the estimated start times, so the whole schedule is sent again
+				schedule := TransformDelayedHoraro(*endpoint, event.Horaro).V2()
+				message = websocketMessage{Type: "schedule", Endpoint: parameter, Meta: &schedule.Meta, Data: schedule}
+			default:
+				continue
+			}
+
+			err := s.send(message)
+			if err != nil {
+				s.conn.Close()
+				return
+			}
+		}
+
+		// The hub closes the events of subscribers that fall behind, unless the client unsubscribed itself
+		s.mu.Lock()
+		dropped := s.subscriptions[parameter] == subscription
+		if dropped {
+			delete(s.subscriptions, parameter)
+		}
+		s.mu.Unlock()
+
+		if dropped && s.sendError(parameter, "Subscription dropped for falling behind, subscribe again") != nil {
+			s.conn.Close()
+		}
+	}()
+
+	return nil
+}
+
+func (s *websocketSession) unsubscribe(parameter string) {
+	s.mu.Lock()
+	subscription, ok := s.subscriptions[parameter]
+	delete(s.subscriptions, parameter)
+	s.mu.Unlock()
+
+	if ok {
+		subscription.unsubscribe()
+	}
+}
+
+func (s *websocketSession) unsubscribeAll() {
+	s.mu.Lock()
+	subscriptions := s.subscriptions
+	s.subscriptions = make(map[string]*websocketSubscription)
+	s.mu.Unlock()
+
+	for _, subscription := range subscriptions {
+		subscription.unsubscribe()
+	}
+}
+
+// websocketHandler lets clients subscribe to schedules, they get the schedule and afterwards the changes to it
+func websocketHandler(w http.ResponseWriter, r *http.Request) {
+	// The upgrader responds with an error itself when the handshake fails
+	conn, err := websocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(maxWebsocketMessage)
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * pingInterval))
+	})
+
+	session := &websocketSession{conn: conn, subscriptions: make(map[string]*websocketSubscription)}
+	defer session.unsubscribeAll()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)) != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * pingInterval))
+
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				log.Printf("Closing websocket: %s", err.Error())
+			}
+			return
+		}
+
+		var command websocketCommand
+		if messageType != websocket.TextMessage || json.Unmarshal(message, &command) != nil || command.Endpoint == "" {
+			err = session.sendError("", "Expected a JSON command like {\"type\":\"subscribe\",\"endpoint\":\"2024-one\"}")
+		} else if command.Type == "subscribe" {
+			err = session.subscribe(command.Endpoint)
+		} else if command.Type == "unsubscribe" {
+			session.unsubscribe(command.Endpoint)
+		} else {
+			err = session.sendError(command.Endpoint, fmt.Sprintf("Unknown command type '%s'", command.Type))
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}